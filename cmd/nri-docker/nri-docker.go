@@ -1,11 +1,18 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/docker/docker/client"
 	nrdocker "github.com/newrelic-experimental/nri-docker/internal/docker"
 	"github.com/newrelic-experimental/nri-docker/internal/lib"
+	"github.com/newrelic-experimental/nri-docker/internal/sink"
 
 	"github.com/newrelic/infra-integrations-sdk/integration"
 	"github.com/newrelic/infra-integrations-sdk/log"
@@ -16,46 +23,198 @@ var err error
 
 func main() {
 	i, err := integration.New(lib.IntegrationName, lib.IntegrationVersion, integration.Args(&lib.Args))
-	lib.PanicOnErr(err)
-	integrationWithLocalEntity(i)
-	lib.PanicOnErr(i.Publish())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := lib.ConfigureRedaction(lib.Args.Redact, lib.Args.RedactPatterns); err != nil {
+		log.Fatal(err)
+	}
+	if err := nrdocker.ConfigureLogPatterns(lib.Args.LogPatterns); err != nil {
+		log.Fatal(err)
+	}
+	if _, err := nrdocker.DaemonPolicy(); err != nil {
+		log.Fatal(err)
+	}
+	if err := lib.OpenState(lib.Args.StatePath); err != nil {
+		log.Warn("cannot open state, growth rates are kept in memory only: %v", err)
+	}
+	sinks, err := sink.New(lib.Args.Sinks, i)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// an interrupted run still publishes whatever it gathered so far
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	endpoints, err := nrdocker.Endpoints()
+	if err != nil {
+		log.Fatal(err)
+	}
+	targets := connect(endpoints)
+	if lib.Args.Daemon {
+		runDaemon(ctx, sinks, targets)
+		return
+	}
+
+	runCtx, cancel := lib.RunContext(ctx)
+	payload := collect(runCtx, targets)
+	cancel()
+	if err := sink.Publish(sinks, payload); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// target is one engine and its client, either cli or containerd is set unless
+// err tells why the client could not be created
+type target struct {
+	endpoint   nrdocker.Endpoint
+	cli        *client.Client
+	containerd *nrdocker.Containerd
+	err        error
+}
+
+func connect(endpoints []nrdocker.Endpoint) []target {
+	targets := []target{}
+	for _, endpoint := range endpoints {
+		if endpoint.Containerd {
+			containerd := nrdocker.NewContainerd(strings.TrimPrefix(endpoint.Host, "unix://"))
+			targets = append(targets, target{endpoint: endpoint, containerd: containerd})
+			continue
+		}
+		cli, err := endpoint.NewClient(lib.Args.APIVersion)
+		targets = append(targets, target{endpoint: endpoint, cli: cli, err: err})
+	}
+	return targets
 }
 
-var entity *integration.Entity
-var cli *client.Client
+// runDaemon keeps stats subscriptions open and publishes on every tick, the
+// first publish waits one interval so the streams have readings to aggregate.
+// Engines whose client could not be created are reported like in a single run
+// and retried on every tick, the healthy ones are collected meanwhile.
+func runDaemon(ctx context.Context, sinks []sink.Sink, targets []target) {
+	for _, t := range targets {
+		if t.cli != nil {
+			nrdocker.StartStatsStreaming(ctx, t.cli)
+		}
+	}
 
-func integrationWithLocalEntity(i *integration.Integration) {
-	lib.Hostname, _ = os.Hostname()
+	interval := time.Duration(lib.Args.Interval) * time.Second
+	if interval <= 0 {
+		interval = 15 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
 
+		for i, t := range targets {
+			if t.err == nil {
+				continue
+			}
+			if cli, err := t.endpoint.NewClient(lib.Args.APIVersion); err == nil {
+				targets[i].cli, targets[i].err = cli, nil
+				nrdocker.StartStatsStreaming(ctx, cli)
+			} else {
+				targets[i].err = err
+			}
+		}
+
+		runCtx, cancel := lib.RunContext(ctx)
+		payload := collect(runCtx, targets)
+		cancel()
+		if err := sink.Publish(sinks, payload); err != nil {
+			log.Error(err.Error())
+		}
+	}
+}
+
+// hostEntity refreshes the hostname and returns the entity host level samples are
+// reported against, named engines get an entity of their own
+func hostEntity(payload *lib.Payload, name string) *lib.Entity {
+	hostname, err := os.Hostname()
+	if err != nil {
+		log.Warn("cannot read hostname: %v", err)
+	}
+	lib.Hostname = hostname
+
+	if name != "" {
+		return payload.Entity(name, "nri-docker")
+	}
 	if lib.Args.Local == true {
-		entity = i.LocalEntity()
-	} else {
-		entity, _ = i.Entity(lib.Hostname, "nri-docker")
+		return payload.LocalEntity()
 	}
+	return payload.Entity(lib.Hostname, "nri-docker")
+}
 
-	lib.PanicOnErr(err)
+// collect runs every collector against each engine in turn, samples of named
+// engines carry a dockerHost attribute so they can be told apart
+func collect(ctx context.Context, targets []target) *lib.Payload {
+	lib.Self.Reset()
+	payload := lib.NewPayload()
+	versions := []string{}
 
-	cli, err = setDockerClient()
-	if err != nil {
-		log.Fatal(err)
+	for _, t := range targets {
+		sub := lib.NewPayload()
+		if t.endpoint.Name != "" {
+			sub.Attributes["dockerHost"] = t.endpoint.Name
+		}
+		entity := hostEntity(sub, t.endpoint.Name)
+		if t.err != nil {
+			// nothing can be collected without a client, but the failure itself is still published
+			lib.ReportError(entity, lib.WrapError(nil, "client", t.endpoint.Host, "", t.err))
+		} else if t.containerd != nil {
+			lib.SwarmState = "inactive"
+			lib.Self.TimeCollector("containerd", func() { nrdocker.GetContainerdInfo(ctx, t.containerd, entity, sub) })
+			versions = append(versions, apiVersion(t))
+		} else {
+			integrationWithLocalEntity(ctx, t.cli, entity, sub)
+			versions = append(versions, apiVersion(t))
+		}
+		payload.Merge(sub)
 	}
 
-	nrdocker.GetHostInfo(cli, entity)
-	nrdocker.GetContainerInfo(cli, entity, i)
-	nrdocker.GetServices(cli, entity)
+	// payloadBytes is the JSON size of everything collected, excluding the self sample itself
+	collected, err := json.Marshal(payload)
+	if err != nil {
+		log.Warn("cannot size payload: %v", err)
+	}
+	lib.Self.Publish(hostEntity(payload, ""), strings.Join(versions, ","), len(collected))
+	if err := lib.SaveState(); err != nil {
+		log.Warn("cannot save state: %v", err)
+	}
+	return payload
+}
 
-	if lib.SwarmState == "active" {
-		nrdocker.GetNodes(cli, entity)
-		nrdocker.GetTasks(cli, entity)
+func apiVersion(t target) string {
+	version := "containerd"
+	if t.cli != nil {
+		version = t.cli.ClientVersion()
+	}
+	if t.endpoint.Name == "" {
+		return version
 	}
+	return t.endpoint.Name + "=" + version
 }
 
-func setDockerClient() (*client.Client, error) {
-	var err error
-	if lib.Args.APIVersion != "" {
-		cli, err = client.NewClientWithOpts(client.WithVersion(lib.Args.APIVersion))
-	} else {
-		cli, err = client.NewClientWithOpts(client.WithAPIVersionNegotiation())
+func integrationWithLocalEntity(ctx context.Context, cli *client.Client, entity *lib.Entity, payload *lib.Payload) {
+	lib.SwarmState = "inactive"
+	lib.Runtime = "docker"
+	lib.CgroupDriver = ""
+	lib.Self.TimeCollector("hostInfo", func() { nrdocker.GetHostInfo(ctx, cli, entity) })
+	lib.Self.TimeCollector("containers", func() { nrdocker.GetContainerInfo(ctx, cli, entity, payload) })
+	lib.Self.TimeCollector("services", func() { nrdocker.GetServices(ctx, cli, entity) })
+
+	if lib.Runtime == "podman" {
+		lib.Self.TimeCollector("pods", func() { nrdocker.GetPods(ctx, cli, entity, payload) })
+	}
+
+	if lib.SwarmState == "active" {
+		lib.Self.TimeCollector("nodes", func() { nrdocker.GetNodes(ctx, cli, entity) })
+		lib.Self.TimeCollector("tasks", func() { nrdocker.GetTasks(ctx, cli, entity) })
 	}
-	return cli, err
 }
@@ -5,6 +5,7 @@ go 1.19
 require (
 	github.com/docker/docker v17.12.0-ce-rc1.0.20190607191414-238f8eaa31aa+incompatible
 	github.com/newrelic/infra-integrations-sdk v3.3.1+incompatible
+	golang.org/x/net v0.0.0-20180826012351-8a410e7b638d
 	vbom.ml/util v0.0.0-20180919145318-efcd4e0f9787
 )
 
@@ -12,8 +13,8 @@ require (
 	github.com/Azure/go-ansiterm v0.0.0-20210617225240-d185dfc1b5a1 // indirect
 	github.com/Microsoft/go-winio v0.4.8 // indirect
 	github.com/docker/distribution v2.7.1-0.20190205005809-0d3efadf0154+incompatible // indirect
-	github.com/docker/go-connections v0.4.0 // indirect
-	github.com/docker/go-units v0.3.3 // indirect
+	github.com/docker/go-connections v0.4.0
+	github.com/docker/go-units v0.3.3
 	github.com/gogo/protobuf v1.0.0 // indirect
 	github.com/golang/protobuf v1.3.2 // indirect
 	github.com/google/go-cmp v0.5.9 // indirect
@@ -26,8 +27,8 @@ require (
 	github.com/sirupsen/logrus v1.1.2-0.20181021100920-4fabf2fffcec // indirect
 	github.com/xlab/handysort v0.0.0-20150421192137-fb3537ed64a1 // indirect
 	golang.org/x/crypto v0.0.0-20181015023909-0c41d7ab0a0e // indirect
-	golang.org/x/net v0.0.0-20180826012351-8a410e7b638d // indirect
 	golang.org/x/sys v0.0.0-20210616094352-59db8d763f22 // indirect
+	golang.org/x/text v0.3.0 // indirect
 	golang.org/x/time v0.3.0 // indirect
 	google.golang.org/genproto v0.0.0-20181016170114-94acd270e44e // indirect
 	google.golang.org/grpc v1.2.1-0.20181023180738-d7518259e000 // indirect
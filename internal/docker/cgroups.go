@@ -0,0 +1,343 @@
+package nrdocker
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/newrelic-experimental/nri-docker/internal/lib"
+)
+
+// clockTicks is USER_HZ, the unit of /proc/stat
+const clockTicks = 100
+
+// vmSockets are parts of socket paths of engines that listen on this host but run their
+// containers in a VM, eg. Docker Desktop and podman machine
+var vmSockets = []string{"/.docker/desktop/", "/.docker/run/", "/com.docker.docker/", "/podman/machine/", "/.colima/", "/.rd/"}
+
+// hostPath places an absolute host path below HostRoot
+func hostPath(path string) string {
+	return filepath.Join(lib.Args.HostRoot, path)
+}
+
+// isLocalDaemon tells whether the containers of cli's daemon run on this host, so their /proc,
+// cgroup and log files can be read below HostRoot. Remote daemons, engines running containers
+// in a VM and --host_files=false are not.
+func isLocalDaemon(cli *client.Client) bool {
+	if !lib.Args.HostFiles || runtime.GOOS != "linux" || !strings.HasPrefix(cli.DaemonHost(), "unix://") {
+		return false
+	}
+	// /var/run/docker.sock may link to the socket of a VM
+	socket := strings.TrimPrefix(cli.DaemonHost(), "unix://")
+	paths := []string{socket}
+	for _, path := range []string{socket, hostPath(socket)} {
+		if target, err := os.Readlink(path); err == nil {
+			paths = append(paths, target)
+		}
+	}
+	for _, path := range paths {
+		for _, vm := range vmSockets {
+			if strings.Contains(path, vm) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// cgroup locates the cgroup directories of a process on the host
+type cgroup struct {
+	v2 bool
+	// dirs maps a v1 controller to its directory, v2 has a single unified directory under ""
+	dirs map[string]string
+}
+
+// cgroupOf reads /proc/<pid>/cgroup
+func cgroupOf(pid int) (*cgroup, error) {
+	file, err := os.Open(hostPath(fmt.Sprintf("/proc/%d/cgroup", pid)))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	root := hostPath("/sys/fs/cgroup")
+	cg := &cgroup{dirs: map[string]string{}}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// hierarchy-ID:controller-list:path
+		parts := strings.SplitN(scanner.Text(), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		if parts[0] == "0" && parts[1] == "" {
+			cg.dirs[""] = filepath.Join(root, parts[2])
+			continue
+		}
+		for _, controller := range strings.Split(parts[1], ",") {
+			controller = strings.TrimPrefix(controller, "name=")
+			cg.dirs[controller] = filepath.Join(root, controller, parts[2])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	// a hybrid host lists the unified hierarchy next to the v1 controllers
+	_, unified := cg.dirs[""]
+	cg.v2 = unified && len(cg.dirs) == 1
+	return cg, nil
+}
+
+func (c *cgroup) path(controller, name string) string {
+	if c.v2 {
+		return filepath.Join(c.dirs[""], name)
+	}
+	return filepath.Join(c.dirs[controller], name)
+}
+
+func (c *cgroup) read(controller, name string) (string, bool) {
+	raw, err := ioutil.ReadFile(c.path(controller, name))
+	if err != nil {
+		return "", false
+	}
+	return strings.TrimSpace(string(raw)), true
+}
+
+// readUint reads a single value file, "max" reads as 0 like docker reports an unset limit
+func (c *cgroup) readUint(controller, name string) uint64 {
+	raw, ok := c.read(controller, name)
+	if !ok || raw == "max" {
+		return 0
+	}
+	v, _ := strconv.ParseUint(raw, 10, 64)
+	return v
+}
+
+// readKeyValues reads flat keyed files such as memory.stat and cpu.stat
+func (c *cgroup) readKeyValues(controller, name string) map[string]uint64 {
+	values := map[string]uint64{}
+	raw, ok := c.read(controller, name)
+	if !ok {
+		return values
+	}
+	for _, line := range strings.Split(raw, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		if v, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+			values[fields[0]] = v
+		}
+	}
+	return values
+}
+
+// cgroupStats builds a stats reading for the process the way the docker daemon
+// does from the same files, so it can go through setStatsMetrics
+func cgroupStats(pid int) (types.StatsJSON, error) {
+	var stats types.StatsJSON
+	cg, err := cgroupOf(pid)
+	if err != nil {
+		return stats, err
+	}
+
+	if cg.v2 {
+		cpu := cg.readKeyValues("", "cpu.stat")
+		stats.CPUStats.CPUUsage.TotalUsage = cpu["usage_usec"] * 1000
+		stats.CPUStats.CPUUsage.UsageInKernelmode = cpu["system_usec"] * 1000
+		stats.CPUStats.CPUUsage.UsageInUsermode = cpu["user_usec"] * 1000
+		stats.CPUStats.ThrottlingData.Periods = cpu["nr_periods"]
+		stats.CPUStats.ThrottlingData.ThrottledPeriods = cpu["nr_throttled"]
+		stats.CPUStats.ThrottlingData.ThrottledTime = cpu["throttled_usec"] * 1000
+
+		stats.MemoryStats.Usage = cg.readUint("", "memory.current")
+		stats.MemoryStats.Limit = cg.readUint("", "memory.max")
+		stats.MemoryStats.Stats = cg.readKeyValues("", "memory.stat")
+		stats.BlkioStats.IoServiceBytesRecursive, stats.BlkioStats.IoServicedRecursive = readIOStat(cg)
+	} else {
+		stats.CPUStats.CPUUsage.TotalUsage = cg.readUint("cpuacct", "cpuacct.usage")
+		if percpu, ok := cg.read("cpuacct", "cpuacct.usage_percpu"); ok {
+			for _, field := range strings.Fields(percpu) {
+				v, _ := strconv.ParseUint(field, 10, 64)
+				stats.CPUStats.CPUUsage.PercpuUsage = append(stats.CPUStats.CPUUsage.PercpuUsage, v)
+			}
+		}
+		cpu := cg.readKeyValues("cpu", "cpu.stat")
+		stats.CPUStats.ThrottlingData.Periods = cpu["nr_periods"]
+		stats.CPUStats.ThrottlingData.ThrottledPeriods = cpu["nr_throttled"]
+		stats.CPUStats.ThrottlingData.ThrottledTime = cpu["throttled_time"]
+
+		stats.MemoryStats.Usage = cg.readUint("memory", "memory.usage_in_bytes")
+		stats.MemoryStats.MaxUsage = cg.readUint("memory", "memory.max_usage_in_bytes")
+		stats.MemoryStats.Failcnt = cg.readUint("memory", "memory.failcnt")
+		stats.MemoryStats.Limit = cg.readUint("memory", "memory.limit_in_bytes")
+		stats.MemoryStats.Stats = cg.readKeyValues("memory", "memory.stat")
+		stats.BlkioStats.IoServiceBytesRecursive = readBlkioV1(cg, "io_service_bytes_recursive")
+		stats.BlkioStats.IoServicedRecursive = readBlkioV1(cg, "io_serviced_recursive")
+	}
+	// docker reports the host memory as the limit of unlimited containers
+	if total := hostMemTotal(); total > 0 && (stats.MemoryStats.Limit == 0 || stats.MemoryStats.Limit > total) {
+		stats.MemoryStats.Limit = total
+	}
+
+	stats.PidsStats.Current = cg.readUint("pids", "pids.current")
+	stats.PidsStats.Limit = cg.readUint("pids", "pids.max")
+	stats.CPUStats.SystemUsage, stats.CPUStats.OnlineCPUs = systemCPUUsage()
+	stats.Networks = procNetDev(pid)
+	return stats, nil
+}
+
+// readIOStat reads v2 io.stat lines such as "8:0 rbytes=1 wbytes=2 rios=3 wios=4" as
+// the bytes and operations docker reports
+func readIOStat(cg *cgroup) ([]types.BlkioStatEntry, []types.BlkioStatEntry) {
+	bytes, ops := []types.BlkioStatEntry{}, []types.BlkioStatEntry{}
+	for _, device := range readIOStatDevices(cg) {
+		bytes = append(bytes,
+			types.BlkioStatEntry{Major: device.major, Minor: device.minor, Op: "read", Value: device.values["rbytes"]},
+			types.BlkioStatEntry{Major: device.major, Minor: device.minor, Op: "write", Value: device.values["wbytes"]})
+		ops = append(ops,
+			types.BlkioStatEntry{Major: device.major, Minor: device.minor, Op: "read", Value: device.values["rios"]},
+			types.BlkioStatEntry{Major: device.major, Minor: device.minor, Op: "write", Value: device.values["wios"]})
+	}
+	return bytes, ops
+}
+
+// ioStatDevice is one line of io.stat
+type ioStatDevice struct {
+	major  uint64
+	minor  uint64
+	values map[string]uint64
+}
+
+func readIOStatDevices(cg *cgroup) []ioStatDevice {
+	devices := []ioStatDevice{}
+	raw, ok := cg.read("", "io.stat")
+	if !ok {
+		return devices
+	}
+	for _, line := range strings.Split(raw, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		device := ioStatDevice{values: map[string]uint64{}}
+		device.major, device.minor = parseDevice(fields[0])
+		for _, field := range fields[1:] {
+			kv := strings.SplitN(field, "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			if v, err := strconv.ParseUint(kv[1], 10, 64); err == nil {
+				device.values[kv[0]] = v
+			}
+		}
+		devices = append(devices, device)
+	}
+	return devices
+}
+
+// readBlkioV1 reads "8:0 Read 123" lines of blkio.<name>, preferring the throttle
+// controller as the cfq one stays empty on most schedulers
+func readBlkioV1(cg *cgroup, name string) []types.BlkioStatEntry {
+	entries := []types.BlkioStatEntry{}
+	raw, ok := cg.read("blkio", "blkio.throttle."+name)
+	if !ok || raw == "" {
+		raw, _ = cg.read("blkio", "blkio."+name)
+	}
+	for _, line := range strings.Split(raw, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			continue
+		}
+		major, minor := parseDevice(fields[0])
+		v, _ := strconv.ParseUint(fields[2], 10, 64)
+		entries = append(entries, types.BlkioStatEntry{Major: major, Minor: minor, Op: fields[1], Value: v})
+	}
+	return entries
+}
+
+func parseDevice(device string) (uint64, uint64) {
+	parts := strings.SplitN(device, ":", 2)
+	if len(parts) != 2 {
+		return 0, 0
+	}
+	major, _ := strconv.ParseUint(parts[0], 10, 64)
+	minor, _ := strconv.ParseUint(parts[1], 10, 64)
+	return major, minor
+}
+
+// systemCPUUsage returns the host cpu time in nanoseconds and the number of cpus from /proc/stat
+func systemCPUUsage() (uint64, uint32) {
+	raw, err := ioutil.ReadFile(hostPath("/proc/stat"))
+	if err != nil {
+		return 0, 0
+	}
+	var total uint64
+	var cpus uint32
+	for _, line := range strings.Split(string(raw), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || !strings.HasPrefix(fields[0], "cpu") {
+			continue
+		}
+		if fields[0] != "cpu" {
+			cpus++
+			continue
+		}
+		// user nice system idle iowait irq softirq steal, guest time is already part of user
+		for i := 1; i < len(fields) && i <= 8; i++ {
+			v, _ := strconv.ParseUint(fields[i], 10, 64)
+			total += v
+		}
+	}
+	return total * 1e9 / clockTicks, cpus
+}
+
+func hostMemTotal() uint64 {
+	raw, err := ioutil.ReadFile(hostPath("/proc/meminfo"))
+	if err != nil {
+		return 0
+	}
+	for _, line := range strings.Split(string(raw), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "MemTotal:" {
+			kb, _ := strconv.ParseUint(fields[1], 10, 64)
+			return kb * 1024
+		}
+	}
+	return 0
+}
+
+// procNetDev reads the interface counters of the process' network namespace, loopback excluded
+func procNetDev(pid int) map[string]types.NetworkStats {
+	networks := map[string]types.NetworkStats{}
+	raw, err := ioutil.ReadFile(hostPath(fmt.Sprintf("/proc/%d/net/dev", pid)))
+	if err != nil {
+		return networks
+	}
+	for _, line := range strings.Split(string(raw), "\n") {
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		name := strings.TrimSpace(parts[0])
+		fields := strings.Fields(parts[1])
+		if name == "lo" || len(fields) < 16 {
+			continue
+		}
+		v := make([]uint64, 16)
+		for i := range v {
+			v[i], _ = strconv.ParseUint(fields[i], 10, 64)
+		}
+		networks[name] = types.NetworkStats{
+			RxBytes: v[0], RxPackets: v[1], RxErrors: v[2], RxDropped: v[3],
+			TxBytes: v[8], TxPackets: v[9], TxErrors: v[10], TxDropped: v[11],
+		}
+	}
+	return networks
+}
@@ -0,0 +1,144 @@
+package nrdocker
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/newrelic-experimental/nri-docker/internal/lib"
+)
+
+func TestIsLocalDaemon(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("containers only run on this host on linux")
+	}
+	defer func(files bool) { lib.Args.HostFiles = files }(lib.Args.HostFiles)
+	lib.Args.HostFiles = true
+	dir := t.TempDir()
+	desktop := filepath.Join(dir, "docker.sock")
+	if err := os.Symlink("/home/dev/.docker/desktop/docker.sock", desktop); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		host  string
+		local bool
+	}{
+		{"unix:///var/run/docker.sock", true},
+		{"unix:///run/user/1000/docker.sock", true},
+		{"tcp://10.0.0.5:2376", false},
+		{"unix:///home/dev/.docker/desktop/docker.sock", false},
+		{"unix:///home/dev/.local/share/containers/podman/machine/qemu/podman.sock", false},
+		{"unix://" + desktop, false},
+	}
+	for _, tt := range tests {
+		cli, err := client.NewClientWithOpts(client.WithHost(tt.host))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := isLocalDaemon(cli); got != tt.local {
+			t.Errorf("%s is local %v, want %v", tt.host, got, tt.local)
+		}
+	}
+
+	lib.Args.HostFiles = false
+	cli, _ := client.NewClientWithOpts(client.WithHost("unix:///var/run/docker.sock"))
+	if isLocalDaemon(cli) {
+		t.Error("host_files=false still reads host files")
+	}
+}
+
+func TestReadIOStat(t *testing.T) {
+	tests := []struct {
+		name  string
+		stat  string
+		bytes []types.BlkioStatEntry
+		ops   []types.BlkioStatEntry
+	}{
+		{
+			name: "two devices",
+			stat: "8:0 rbytes=1048576 wbytes=4096 rios=20 wios=1 dbytes=0 dios=0\n253:1 rbytes=512 wbytes=0 rios=1 wios=0 dbytes=8192 dios=2\n",
+			bytes: []types.BlkioStatEntry{
+				{Major: 8, Minor: 0, Op: "read", Value: 1048576}, {Major: 8, Minor: 0, Op: "write", Value: 4096},
+				{Major: 253, Minor: 1, Op: "read", Value: 512}, {Major: 253, Minor: 1, Op: "write", Value: 0},
+			},
+			ops: []types.BlkioStatEntry{
+				{Major: 8, Minor: 0, Op: "read", Value: 20}, {Major: 8, Minor: 0, Op: "write", Value: 1},
+				{Major: 253, Minor: 1, Op: "read", Value: 1}, {Major: 253, Minor: 1, Op: "write", Value: 0},
+			},
+		},
+		{
+			name:  "a device without I/O",
+			stat:  "8:16\n",
+			bytes: []types.BlkioStatEntry{},
+			ops:   []types.BlkioStatEntry{},
+		},
+		{
+			name:  "garbled values",
+			stat:  "8:0 rbytes=x wbytes=10 rios wios=1\n",
+			bytes: []types.BlkioStatEntry{{Major: 8, Minor: 0, Op: "read", Value: 0}, {Major: 8, Minor: 0, Op: "write", Value: 10}},
+			ops:   []types.BlkioStatEntry{{Major: 8, Minor: 0, Op: "read", Value: 0}, {Major: 8, Minor: 0, Op: "write", Value: 1}},
+		},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		if err := ioutil.WriteFile(filepath.Join(dir, "io.stat"), []byte(tt.stat), 0644); err != nil {
+			t.Fatal(err)
+		}
+		bytes, ops := readIOStat(&cgroup{v2: true, dirs: map[string]string{"": dir}})
+		if !equalBlkio(bytes, tt.bytes) || !equalBlkio(ops, tt.ops) {
+			t.Errorf("%s: bytes %v and ops %v, want %v and %v", tt.name, bytes, ops, tt.bytes, tt.ops)
+		}
+	}
+
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "io.stat"), []byte("8:0 rbytes=1 dbytes=8192 dios=2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	devices := readIOStatDevices(&cgroup{v2: true, dirs: map[string]string{"": dir}})
+	if len(devices) != 1 || devices[0].values["dbytes"] != 8192 || devices[0].values["dios"] != 2 {
+		t.Errorf("discards %+v", devices)
+	}
+}
+
+func TestReadBlkioV1(t *testing.T) {
+	tests := []struct {
+		name     string
+		throttle string
+		cfq      string
+		entries  []types.BlkioStatEntry
+	}{
+		{"throttle", "8:0 Read 4096\n8:0 Write 512\n8:0 Total 4608\nTotal 4608\n", "8:0 Read 1\n", []types.BlkioStatEntry{{Major: 8, Minor: 0, Op: "Read", Value: 4096}, {Major: 8, Minor: 0, Op: "Write", Value: 512}, {Major: 8, Minor: 0, Op: "Total", Value: 4608}}},
+		{"cfq when throttle is empty", "", "8:16 Read 7\n", []types.BlkioStatEntry{{Major: 8, Minor: 16, Op: "Read", Value: 7}}},
+		{"nothing", "Total 0\n", "", []types.BlkioStatEntry{}},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		files := map[string]string{"blkio.throttle.io_service_bytes": tt.throttle, "blkio.io_service_bytes": tt.cfq}
+		for name, content := range files {
+			if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		entries := readBlkioV1(&cgroup{dirs: map[string]string{"blkio": dir}}, "io_service_bytes")
+		if !equalBlkio(entries, tt.entries) {
+			t.Errorf("%s: %v, want %v", tt.name, entries, tt.entries)
+		}
+	}
+}
+
+func equalBlkio(a, b []types.BlkioStatEntry) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
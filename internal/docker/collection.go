@@ -0,0 +1,75 @@
+package nrdocker
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/newrelic-experimental/nri-docker/internal/lib"
+)
+
+// collectionStats records how the containers of one run were collected and is
+// reported as dockerCollectionSample, so timed out and failed containers are visible
+type collectionStats struct {
+	lock      sync.Mutex
+	start     time.Time
+	collected int
+	timedOut  []string
+	failed    []string
+	skipped   []string
+}
+
+func newCollectionStats() *collectionStats {
+	return &collectionStats{start: time.Now()}
+}
+
+func (c *collectionStats) record(containerID string, err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	switch {
+	case err == nil:
+		c.collected++
+	case lib.ErrorKindOf(err) == lib.ErrorTimeout:
+		c.timedOut = append(c.timedOut, shortID(containerID))
+	default:
+		c.failed = append(c.failed, shortID(containerID))
+	}
+}
+
+// skip records a container never collected because the run deadline passed
+func (c *collectionStats) skip(containerID string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.skipped = append(c.skipped, shortID(containerID))
+}
+
+func (c *collectionStats) publish(ctx context.Context, total int, entity *lib.Entity) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	lib.Self.Add("containersSeen", float64(total))
+	lib.Self.Add("containersSkipped", float64(len(c.skipped)))
+
+	metricSet := lib.NewSample("dockerCollectionSample", entity)
+	lib.SetMetric(metricSet, "hostname", lib.Hostname)
+	lib.SetMetric(metricSet, "containersTotal", total)
+	lib.SetMetric(metricSet, "containersCollected", c.collected)
+	lib.SetMetric(metricSet, "containersTimedOut", len(c.timedOut))
+	lib.SetMetric(metricSet, "containersFailed", len(c.failed))
+	lib.SetMetric(metricSet, "containersSkipped", len(c.skipped))
+	lib.SetMetric(metricSet, "timedOutContainers", strings.Join(c.timedOut, ","))
+	lib.SetMetric(metricSet, "failedContainers", strings.Join(c.failed, ","))
+	lib.SetMetric(metricSet, "skippedContainers", strings.Join(c.skipped, ","))
+	lib.SetMetric(metricSet, "runDeadlineExceeded", ctx.Err() != nil)
+	lib.SetMetric(metricSet, "concurrency", lib.Args.Concurrency)
+	lib.SetMetric(metricSet, "apiTimeout", lib.Args.APITimeout)
+	lib.SetMetric(metricSet, "runTimeout", lib.Args.RunTimeout)
+	lib.SetMetric(metricSet, "durationMs", time.Since(c.start).Nanoseconds()/int64(time.Millisecond))
+}
+
+func shortID(id string) string {
+	if len(id) > 12 {
+		return id[0:12]
+	}
+	return id
+}
@@ -0,0 +1,303 @@
+package nrdocker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/newrelic-experimental/nri-docker/internal/lib"
+)
+
+// defaultDaemonPolicy follows the CIS Docker Benchmark daemon configuration section.
+// A string starting with ! must not match, a list is the allowed values of a setting
+// or the values a list setting must contain, an empty list requires an empty setting.
+var defaultDaemonPolicy = map[string]interface{}{
+	"icc":                false,
+	"insecureRegistries": []interface{}{},
+	"storageDriver":      "!aufs",
+	"defaultUlimits":     true,
+	"securityOptions":    []interface{}{"seccomp"},
+	"liveRestore":        true,
+	"userlandProxy":      false,
+}
+
+// bridgeICCTTL is how long the default bridge's icc option is cached, a daemon restart can change it
+const bridgeICCTTL = 10 * time.Minute
+
+// bridgeICCResult is the icc option of a daemon's default bridge and when it was inspected
+type bridgeICCResult struct {
+	icc       bool
+	inspected time.Time
+}
+
+var (
+	// bridgeICCs caches the default bridge's icc option by daemon ID
+	bridgeICCs = map[string]bridgeICCResult{}
+	bridgeLock sync.Mutex
+)
+
+// daemonConfig is the part of daemon.json not reported by /info
+type daemonConfig struct {
+	UserlandProxy  *bool                  `json:"userland-proxy"`
+	ICC            *bool                  `json:"icc"`
+	DefaultUlimits map[string]interface{} `json:"default-ulimits"`
+}
+
+// DaemonPolicy merges the configured policy, a JSON object of setting to expected
+// value, over the default one. A null value drops a default check.
+func DaemonPolicy() (map[string]interface{}, error) {
+	policy := map[string]interface{}{}
+	for key, val := range defaultDaemonPolicy {
+		policy[key] = val
+	}
+	if strings.TrimSpace(lib.Args.DaemonPolicy) == "" {
+		return policy, nil
+	}
+	configured := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(lib.Args.DaemonPolicy), &configured); err != nil {
+		return nil, fmt.Errorf("cannot parse daemon policy: %v", err)
+	}
+	for key, val := range configured {
+		if val == nil {
+			delete(policy, key)
+			continue
+		}
+		policy[key] = val
+	}
+	return policy, nil
+}
+
+// checkDaemonCompliance reports dockerDaemonComplianceSample with the daemon
+// settings hardening standards care about and a pass/fail per policy check
+func checkDaemonCompliance(ctx context.Context, cli *client.Client, entity *lib.Entity, info daemonInfo) {
+	if !lib.Args.SecurityChecks {
+		return
+	}
+	policy, err := DaemonPolicy()
+	if err != nil {
+		lib.ReportError(entity, lib.WrapError(nil, "compliance", "", "", err))
+		return
+	}
+
+	// nil settings could not be determined, their checks report unknown
+	settings := map[string]interface{}{
+		"liveRestore":     info.LiveRestoreEnabled,
+		"loggingDriver":   info.LoggingDriver,
+		"storageDriver":   info.Driver,
+		"cgroupDriver":    info.CgroupDriver,
+		"securityOptions": securityOptionNames(info.SecurityOptions),
+		"icc":             nil,
+		"userlandProxy":   nil,
+		"defaultUlimits":  nil,
+		"cgroupVersion":   nil,
+	}
+	mirrors, insecure := []string{}, []string{}
+	if registry := info.RegistryConfig; registry != nil {
+		mirrors = append(mirrors, registry.Mirrors...)
+		for _, cidr := range registry.InsecureRegistryCIDRs {
+			// the daemon always trusts loopback registries
+			if cidr.String() != "127.0.0.0/8" {
+				insecure = append(insecure, cidr.String())
+			}
+		}
+		for name, index := range registry.IndexConfigs {
+			if index != nil && !index.Secure {
+				insecure = append(insecure, name)
+			}
+		}
+	}
+	sort.Strings(insecure)
+	settings["registryMirrors"] = mirrors
+	settings["insecureRegistries"] = insecure
+
+	if info.CgroupVersion != "" {
+		settings["cgroupVersion"] = info.CgroupVersion
+	}
+	if icc, ok := bridgeICC(ctx, cli, info.ID); ok {
+		settings["icc"] = icc
+	}
+
+	if isLocalDaemon(cli) {
+		if config, ok := readDaemonConfig(); ok {
+			userlandProxy := config.UserlandProxy == nil || *config.UserlandProxy
+			settings["userlandProxy"] = userlandProxy
+			if settings["icc"] == nil {
+				settings["icc"] = config.ICC == nil || *config.ICC
+			}
+			ulimits := []string{}
+			for name := range config.DefaultUlimits {
+				ulimits = append(ulimits, name)
+			}
+			sort.Strings(ulimits)
+			settings["defaultUlimits"] = ulimits
+		}
+	}
+
+	metricSet := lib.NewSample("dockerDaemonComplianceSample", entity)
+	lib.SetMetric(metricSet, "hostname", lib.Hostname)
+	lib.SetMetric(metricSet, "daemonHost", cli.DaemonHost())
+	lib.SetMetric(metricSet, "warnings", len(info.Warnings))
+	for name, val := range settings {
+		lib.SetMetric(metricSet, name, settingString(val))
+	}
+
+	names := []string{}
+	for name := range policy {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	passed, failed, unknown := 0, []string{}, 0
+	for _, name := range names {
+		result := evaluatePolicy(policy[name], settings[name])
+		switch result {
+		case "pass":
+			passed++
+		case "fail":
+			failed = append(failed, name)
+		default:
+			unknown++
+		}
+		lib.SetMetric(metricSet, "check."+name, result)
+		lib.SetMetric(metricSet, "policy."+name, settingString(policy[name]))
+	}
+	lib.SetMetric(metricSet, "checksPassed", passed)
+	lib.SetMetric(metricSet, "checksFailed", len(failed))
+	lib.SetMetric(metricSet, "checksUnknown", unknown)
+	lib.SetMetric(metricSet, "failedChecks", strings.Join(failed, ","))
+}
+
+// bridgeICC tells whether the default bridge allows inter container communication, which
+// follows the daemon's --icc. It only changes with a daemon restart, so it is inspected again
+// once bridgeICCTTL has passed rather than every run.
+func bridgeICC(ctx context.Context, cli *client.Client, daemonID string) (bool, bool) {
+	key := cli.DaemonHost() + "/" + daemonID
+	bridgeLock.Lock()
+	defer bridgeLock.Unlock()
+	if cached, ok := bridgeICCs[key]; ok && time.Since(cached.inspected) < bridgeICCTTL {
+		return cached.icc, true
+	}
+	callCtx, cancel := lib.CallContext(ctx)
+	bridge, err := cli.NetworkInspect(callCtx, "bridge", types.NetworkInspectOptions{})
+	cancel()
+	if err != nil {
+		return false, false
+	}
+	option, ok := bridge.Options["com.docker.network.bridge.enable_icc"]
+	if !ok {
+		return false, false
+	}
+	bridgeICCs[key] = bridgeICCResult{icc: option == "true", inspected: time.Now()}
+	return option == "true", true
+}
+
+// readDaemonConfig reads daemon.json of a local daemon. A missing file means every setting has
+// its default, a file that cannot be read or parsed leaves the settings unknown.
+func readDaemonConfig() (daemonConfig, bool) {
+	var config daemonConfig
+	raw, err := ioutil.ReadFile(hostPath(lib.Args.DaemonConfig))
+	if os.IsNotExist(err) {
+		return config, true
+	}
+	if err != nil {
+		return config, false
+	}
+	if err := json.Unmarshal(raw, &config); err != nil {
+		return config, false
+	}
+	return config, true
+}
+
+// securityOptionNames turns "name=seccomp,profile=default" entries into seccomp
+func securityOptionNames(options []string) []string {
+	names := []string{}
+	for _, option := range options {
+		for _, field := range strings.Split(option, ",") {
+			if strings.HasPrefix(field, "name=") {
+				names = append(names, strings.TrimPrefix(field, "name="))
+			}
+		}
+	}
+	return names
+}
+
+// evaluatePolicy compares a setting with its expected value, unknown when the setting could not be read
+func evaluatePolicy(expected, actual interface{}) string {
+	if actual == nil {
+		return "unknown"
+	}
+	result := false
+	switch want := expected.(type) {
+	case bool:
+		switch got := actual.(type) {
+		case bool:
+			result = got == want
+		case []string:
+			// true requires the list setting to be configured
+			result = (len(got) > 0) == want
+		}
+	case string:
+		got := fmt.Sprintf("%v", actual)
+		if strings.HasPrefix(want, "!") {
+			result = got != strings.TrimPrefix(want, "!")
+		} else {
+			result = got == want
+		}
+	case []interface{}:
+		switch got := actual.(type) {
+		case []string:
+			if len(want) == 0 {
+				result = len(got) == 0
+				break
+			}
+			result = true
+			for _, w := range want {
+				if !containsString(got, fmt.Sprintf("%v", w)) {
+					result = false
+				}
+			}
+		default:
+			for _, w := range want {
+				if fmt.Sprintf("%v", w) == fmt.Sprintf("%v", got) {
+					result = true
+				}
+			}
+		}
+	}
+	if result {
+		return "pass"
+	}
+	return "fail"
+}
+
+func settingString(val interface{}) string {
+	switch v := val.(type) {
+	case nil:
+		return "unknown"
+	case []string:
+		return strings.Join(v, ",")
+	case []interface{}:
+		values := []string{}
+		for _, item := range v {
+			values = append(values, fmt.Sprintf("%v", item))
+		}
+		return strings.Join(values, ",")
+	}
+	return fmt.Sprintf("%v", val)
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
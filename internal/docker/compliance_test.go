@@ -0,0 +1,54 @@
+package nrdocker
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/newrelic-experimental/nri-docker/internal/lib"
+)
+
+func TestReadDaemonConfig(t *testing.T) {
+	defer func(root, config string) { lib.Args.HostRoot, lib.Args.DaemonConfig = root, config }(lib.Args.HostRoot, lib.Args.DaemonConfig)
+	lib.Args.HostRoot = t.TempDir()
+	if err := os.MkdirAll(hostPath("/etc/docker/daemon.d"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"/etc/docker/daemon.json": `{"userland-proxy": false, "icc": false, "default-ulimits": {"nofile": {"Soft": 64000}}}`,
+		"/etc/docker/broken.json": `{"userland-proxy": fal`,
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(hostPath(name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		path     string
+		ok       bool
+		ulimits  int
+		defaults bool
+	}{
+		{"/etc/docker/daemon.json", true, 1, false},
+		{"/etc/docker/missing.json", true, 0, true},
+		{"/etc/docker/broken.json", false, 0, false},
+		// any read error other than a missing file leaves the settings unknown
+		{"/etc/docker/daemon.d", false, 0, false},
+	}
+	for _, tt := range tests {
+		lib.Args.DaemonConfig = tt.path
+		config, ok := readDaemonConfig()
+		if ok != tt.ok {
+			t.Errorf("%s: ok %v, want %v", filepath.Base(tt.path), ok, tt.ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if len(config.DefaultUlimits) != tt.ulimits || (config.UserlandProxy == nil) != tt.defaults || (config.ICC == nil) != tt.defaults {
+			t.Errorf("%s: %+v", filepath.Base(tt.path), config)
+		}
+	}
+}
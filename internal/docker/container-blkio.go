@@ -0,0 +1,105 @@
+package nrdocker
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/newrelic-experimental/nri-docker/internal/lib"
+)
+
+// blkioDevice sums the blkio entries of one major:minor device
+type blkioDevice struct {
+	major, minor uint64
+	values       map[string]uint64
+}
+
+// setBlkioMetrics reports a dockerContainerBlkioSample per block device the container did
+// I/O on, with rates against the previous run. pid is the container's process on this host,
+// 0 when its cgroup cannot be read here. cli is nil for containerd tasks, which run on this host.
+func setBlkioMetrics(cli *client.Client, entity *lib.Entity, containerID, containerName string, pid int, blkio types.BlkioStats) {
+	devices := map[string]*blkioDevice{}
+	add := func(entries []types.BlkioStatEntry, metric string) {
+		for _, entry := range entries {
+			op := strings.ToLower(entry.Op)
+			key := fmt.Sprintf("%d:%d", entry.Major, entry.Minor)
+			device, ok := devices[key]
+			if !ok {
+				device = &blkioDevice{major: entry.Major, minor: entry.Minor, values: map[string]uint64{}}
+				devices[key] = device
+			}
+			switch op {
+			case "read", "write":
+				device.values[op+metric] += entry.Value
+			case "total", "":
+				// v1 queue and time files report per op and a total, sync and async split the same
+				device.values["total"+metric] += entry.Value
+			}
+		}
+	}
+	add(blkio.IoServiceBytesRecursive, "Bytes")
+	add(blkio.IoServicedRecursive, "Ops")
+	add(blkio.IoQueuedRecursive, "QueuedOps")
+	add(blkio.IoServiceTimeRecursive, "ServiceTimeNs")
+	add(blkio.IoWaitTimeRecursive, "WaitTimeNs")
+	add(blkio.IoMergedRecursive, "MergedOps")
+
+	// v2 io.stat also has discards, and nothing for queue and wait times
+	if pid > 0 {
+		if cg, err := cgroupOf(pid); err == nil && cg.v2 {
+			for _, d := range readIOStatDevices(cg) {
+				if device, ok := devices[fmt.Sprintf("%d:%d", d.major, d.minor)]; ok {
+					device.values["discardBytes"] = d.values["dbytes"]
+					device.values["discardOps"] = d.values["dios"]
+				}
+			}
+		}
+	}
+
+	// device names are only known to the host the devices are on
+	local := cli == nil || isLocalDaemon(cli)
+	keys := []string{}
+	for key := range devices {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		device := devices[key]
+		metricSet := lib.NewSample("dockerContainerBlkioSample", entity)
+		lib.SetMetric(metricSet, "hostname", lib.Hostname)
+		lib.SetMetric(metricSet, "containerId", containerID)
+		lib.SetMetric(metricSet, "IDShort", shortID(containerID))
+		lib.SetMetric(metricSet, "containerName", containerName)
+		if local {
+			lib.SetMetric(metricSet, "device", blockDeviceName(device.major, device.minor))
+		} else {
+			lib.SetMetric(metricSet, "device", key)
+		}
+		lib.SetMetric(metricSet, "deviceMajorMinor", key)
+		for name, val := range device.values {
+			lib.SetMetric(metricSet, name, val)
+		}
+		for _, op := range []string{"read", "write"} {
+			prefix := "blkio/" + containerID + "/" + key + "/" + op
+			if rate, ok := lib.Rate(prefix+"/bytes", float64(device.values[op+"Bytes"])); ok {
+				lib.SetMetric(metricSet, op+"BytesPerSecond", rate)
+			}
+			if rate, ok := lib.Rate(prefix+"/ops", float64(device.values[op+"Ops"])); ok {
+				lib.SetMetric(metricSet, op+"Iops", rate)
+			}
+		}
+	}
+}
+
+// blockDeviceName resolves major:minor through /sys/dev/block, eg. 8:0 to sda
+func blockDeviceName(major, minor uint64) string {
+	link, err := os.Readlink(hostPath(fmt.Sprintf("/sys/dev/block/%d:%d", major, minor)))
+	if err != nil {
+		return fmt.Sprintf("%d:%d", major, minor)
+	}
+	return filepath.Base(link)
+}
@@ -0,0 +1,48 @@
+package nrdocker
+
+import (
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/newrelic-experimental/nri-docker/internal/lib"
+)
+
+func TestSetBlkioMetricsDevice(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("block devices are resolved on linux only")
+	}
+	defer func(root string, files bool) { lib.Args.HostRoot, lib.Args.HostFiles = root, files }(lib.Args.HostRoot, lib.Args.HostFiles)
+	lib.Args.HostRoot, lib.Args.HostFiles = t.TempDir(), true
+	if err := os.MkdirAll(hostPath("/sys/dev/block"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("../../devices/pci0000:00/0000:00:1f.2/ata1/host0/target0:0:0/0:0:0:0/block/sda", hostPath("/sys/dev/block/8:0")); err != nil {
+		t.Fatal(err)
+	}
+	local, _ := client.NewClientWithOpts(client.WithHost("unix:///var/run/docker.sock"))
+	remote, _ := client.NewClientWithOpts(client.WithHost("tcp://10.0.0.5:2376"))
+	blkio := types.BlkioStats{IoServiceBytesRecursive: []types.BlkioStatEntry{{Major: 8, Minor: 0, Op: "read", Value: 4096}}}
+
+	tests := []struct {
+		name string
+		cli  *client.Client
+		want string
+	}{
+		{"a local daemon", local, "sda"},
+		{"a containerd task", nil, "sda"},
+		{"a remote daemon", remote, "8:0"},
+	}
+	for _, tt := range tests {
+		entity := lib.NewPayload().LocalEntity()
+		setBlkioMetrics(tt.cli, entity, "4fa6e0f0c678", "web", 0, blkio)
+		if len(entity.Samples) != 1 {
+			t.Fatalf("%s: %d samples", tt.name, len(entity.Samples))
+		}
+		if got := entity.Samples[0].Metrics["device"]; got != tt.want {
+			t.Errorf("%s: device %v, want %s", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package nrdocker
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/newrelic-experimental/nri-docker/internal/lib"
+)
+
+// pressureResources are the cgroup v2 PSI files read per container
+var pressureResources = []string{"cpu", "memory", "io"}
+
+// containerCgroup finds the cgroup of a container from its process, or when /proc is not
+// readable from the cgroup driver's naming: systemd puts containers in
+// <parent slice>/docker-<id>.scope, cgroupfs in <parent>/<id>
+func containerCgroup(pid int, id, parent string) (*cgroup, bool) {
+	if pid > 0 {
+		if cg, err := cgroupOf(pid); err == nil {
+			return cg, true
+		}
+	}
+	if id == "" {
+		return nil, false
+	}
+	root := hostPath("/sys/fs/cgroup")
+	// only the unified hierarchy has a single path per container
+	if _, err := os.Stat(filepath.Join(root, "cgroup.controllers")); err != nil {
+		return nil, false
+	}
+	var dir string
+	switch lib.CgroupDriver {
+	case "systemd":
+		if parent == "" {
+			parent = "system.slice"
+		}
+		dir = filepath.Join(root, expandSlice(parent), "docker-"+id+".scope")
+	case "cgroupfs":
+		if parent == "" {
+			parent = "/docker"
+		}
+		dir = filepath.Join(root, parent, id)
+	default:
+		return nil, false
+	}
+	if _, err := os.Stat(dir); err != nil {
+		return nil, false
+	}
+	return &cgroup{v2: true, dirs: map[string]string{"": dir}}, true
+}
+
+// expandSlice turns a systemd slice such as a-b.slice into its path a.slice/a-b.slice
+func expandSlice(slice string) string {
+	name := strings.TrimSuffix(slice, ".slice")
+	if name == slice || strings.Contains(slice, "/") {
+		// not a slice name, cgroupfs style parent
+		return slice
+	}
+	path, prefix := "", ""
+	for _, part := range strings.Split(name, "-") {
+		prefix += part
+		path = filepath.Join(path, prefix+".slice")
+		prefix += "-"
+	}
+	return path
+}
+
+// setCgroupMetrics adds what the stats API leaves out from the container's cgroup. pid is 0
+// and parent empty when they are unknown, nothing is read for containers of other hosts.
+// It returns the cgroup's oom kill counter when the kernel reports one.
+func setCgroupMetrics(metricSet *lib.Sample, pid int, id, parent string) (float64, bool) {
+	cg, ok := containerCgroup(pid, id, parent)
+	if !ok {
+		return 0, false
+	}
+	if !cg.v2 {
+		// oom_kill_disable 0, under_oom 0 and since linux 4.13 oom_kill 1
+		control := cg.readKeyValues("memory", "memory.oom_control")
+		if _, ok := control["oom_kill_disable"]; ok {
+			lib.SetMetric(metricSet, "memOomKillDisable", control["oom_kill_disable"] == 1)
+			lib.SetMetric(metricSet, "memUnderOom", control["under_oom"] == 1)
+		}
+		kills, ok := control["oom_kill"]
+		if ok {
+			lib.SetMetric(metricSet, "memEventsOomKill", kills)
+		}
+		return float64(kills), ok
+	}
+
+	// v2 keeps swap out of memory.stat
+	if _, ok := cg.read("", "memory.swap.current"); ok {
+		lib.SetMetric(metricSet, "memSwapBytes", cg.readUint("", "memory.swap.current"))
+	}
+	setPressureMetrics(metricSet, cg, id)
+
+	// low, high, max, oom, oom_kill and oom_group_kill
+	events := cg.readKeyValues("", "memory.events")
+	for key, val := range events {
+		name := ""
+		for _, part := range strings.Split(key, "_") {
+			name += upperFirst(part)
+		}
+		lib.SetMetric(metricSet, "memEvents"+name, val)
+	}
+	if max, ok := events["max"]; ok {
+		// docker reports no failcnt on v2, hitting memory.max is the closest
+		lib.SetMetric(metricSet, "memFailCount", max)
+	}
+	kills, ok := events["oom_kill"]
+	return float64(kills), ok
+}
+
+// setPressureMetrics reports the pressure stall information of the cgroup, eg.
+// memoryPressureSomeAvg10, and the share of the time since the previous run stalled
+func setPressureMetrics(metricSet *lib.Sample, cg *cgroup, id string) {
+	for _, resource := range pressureResources {
+		raw, ok := cg.read("", resource+".pressure")
+		if !ok {
+			continue
+		}
+		// some avg10=0.00 avg60=0.00 avg300=0.00 total=0
+		for _, line := range strings.Split(raw, "\n") {
+			fields := strings.Fields(line)
+			if len(fields) < 2 || (fields[0] != "some" && fields[0] != "full") {
+				continue
+			}
+			prefix := resource + "Pressure" + upperFirst(fields[0])
+			for _, field := range fields[1:] {
+				kv := strings.SplitN(field, "=", 2)
+				if len(kv) != 2 {
+					continue
+				}
+				v, err := strconv.ParseFloat(kv[1], 64)
+				if err != nil {
+					continue
+				}
+				switch kv[0] {
+				case "avg10", "avg60", "avg300":
+					lib.SetMetric(metricSet, prefix+upperFirst(kv[0]), v)
+				case "total":
+					// microseconds stalled
+					lib.SetMetric(metricSet, prefix+"TotalUs", v)
+					if id == "" {
+						continue
+					}
+					if rate, ok := lib.Rate("pressure/"+id+"/"+resource+"/"+fields[0], v); ok {
+						lib.SetMetric(metricSet, prefix+"StallPercent", rate/1e4)
+					}
+				}
+			}
+		}
+	}
+}
+
+func upperFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
@@ -0,0 +1,79 @@
+package nrdocker
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/newrelic-experimental/nri-docker/internal/lib"
+)
+
+func TestSetPressureMetrics(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]string
+		metrics  map[string]float64
+		excluded []string
+	}{
+		{
+			name: "some and full",
+			files: map[string]string{
+				"cpu.pressure":    "some avg10=1.50 avg60=0.75 avg300=0.20 total=123456\nfull avg10=0.00 avg60=0.00 avg300=0.00 total=0\n",
+				"memory.pressure": "some avg10=12.34 avg60=5.00 avg300=1.00 total=9000000\nfull avg10=10.00 avg60=4.00 avg300=0.50 total=8000000\n",
+			},
+			metrics: map[string]float64{
+				"cpuPressureSomeAvg10":      1.5,
+				"cpuPressureSomeAvg60":      0.75,
+				"cpuPressureSomeAvg300":     0.2,
+				"cpuPressureSomeTotalUs":    123456,
+				"cpuPressureFullTotalUs":    0,
+				"memoryPressureSomeAvg10":   12.34,
+				"memoryPressureFullAvg10":   10,
+				"memoryPressureFullAvg300":  0.5,
+				"memoryPressureFullTotalUs": 8000000,
+			},
+			excluded: []string{"ioPressureSomeAvg10", "cpuPressureSomeStallPercent"},
+		},
+		{
+			name: "a kernel without full cpu pressure",
+			files: map[string]string{
+				"cpu.pressure": "some avg10=0.10 avg60=0.00 avg300=0.00 total=42\n",
+				"io.pressure":  "some avg10=3.00 avg60=1.00 avg300=0.00 total=100\nfull avg10=2.00 avg60=0.50 avg300=0.00 total=80\n",
+			},
+			metrics: map[string]float64{
+				"cpuPressureSomeTotalUs": 42,
+				"ioPressureSomeAvg10":    3,
+				"ioPressureFullAvg60":    0.5,
+				"ioPressureFullTotalUs":  80,
+			},
+			excluded: []string{"cpuPressureFullAvg10", "memoryPressureSomeAvg10"},
+		},
+		{
+			name:     "garbled lines",
+			files:    map[string]string{"cpu.pressure": "some avg10=x avg60 total=7\npartial avg10=1.00\n"},
+			metrics:  map[string]float64{"cpuPressureSomeTotalUs": 7},
+			excluded: []string{"cpuPressureSomeAvg10", "cpuPressureSomeAvg60", "cpuPressurePartialAvg10"},
+		},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		for name, content := range tt.files {
+			if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		metricSet := lib.NewPayload().Entity("web", "docker").NewSample("ContainerSample")
+		// the first reading of a container has no stall share yet
+		setPressureMetrics(metricSet, &cgroup{v2: true, dirs: map[string]string{"": dir}}, "psi-"+tt.name)
+		for key, want := range tt.metrics {
+			if metricSet.Metrics[key] != want {
+				t.Errorf("%s: %s = %v, want %v", tt.name, key, metricSet.Metrics[key], want)
+			}
+		}
+		for _, key := range tt.excluded {
+			if val, ok := metricSet.Metrics[key]; ok {
+				t.Errorf("%s: unexpected %s = %v", tt.name, key, val)
+			}
+		}
+	}
+}
@@ -0,0 +1,304 @@
+package nrdocker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/docker/go-units"
+	"github.com/newrelic-experimental/nri-docker/internal/lib"
+)
+
+// log drivers that write files below the daemon's root dir, and their rotation defaults
+var fileLogDrivers = map[string]struct {
+	maxSize string
+	maxFile string
+}{
+	"json-file": {maxSize: "", maxFile: "1"},
+	"local":     {maxSize: "20m", maxFile: "5"},
+}
+
+// patterns counted in container logs unless configured otherwise
+var defaultLogPatterns = map[string]string{
+	"error":     `(?i)\berror\b`,
+	"exception": `(?i)exception`,
+	"panic":     `(?i)\bpanic\b`,
+}
+
+// maxLogLine bounds how much of a line without newline is buffered
+const maxLogLine = 64 * 1024
+
+type logPattern struct {
+	name    string
+	pattern *regexp.Regexp
+}
+
+// logPatterns are counted by setLogPatternMetrics, in name order
+var logPatterns = []logPattern{}
+
+// ConfigureLogPatterns compiles patterns, a JSON object of name to regular expression,
+// merged over the default ones. A null value drops a default pattern.
+func ConfigureLogPatterns(patterns string) error {
+	sources := map[string]string{}
+	for name, source := range defaultLogPatterns {
+		sources[name] = source
+	}
+	if strings.TrimSpace(patterns) != "" {
+		configured := map[string]*string{}
+		if err := json.Unmarshal([]byte(patterns), &configured); err != nil {
+			return fmt.Errorf("cannot parse log patterns: %v", err)
+		}
+		for name, source := range configured {
+			if source == nil {
+				delete(sources, name)
+				continue
+			}
+			sources[name] = *source
+		}
+	}
+
+	compiled := []logPattern{}
+	for name, source := range sources {
+		pattern, err := regexp.Compile(source)
+		if err != nil {
+			return fmt.Errorf("cannot compile log pattern %s %q: %v", name, source, err)
+		}
+		compiled = append(compiled, logPattern{name: name, pattern: pattern})
+	}
+	sort.Slice(compiled, func(i, j int) bool { return compiled[i].name < compiled[j].name })
+	logPatterns = compiled
+	return nil
+}
+
+// logMatch is the last line that matched a pattern
+type logMatch struct {
+	line    string
+	pattern string
+	stream  string
+	time    time.Time
+}
+
+// logCounter counts the lines of one stream written to it and their pattern matches
+type logCounter struct {
+	stream  string
+	until   time.Time
+	lines   int
+	counts  map[string]int
+	last    *logMatch
+	partial []byte
+}
+
+func newLogCounter(stream string, until time.Time, last *logMatch) *logCounter {
+	return &logCounter{stream: stream, until: until, counts: map[string]int{}, last: last}
+}
+
+func (c *logCounter) Write(p []byte) (int, error) {
+	c.partial = append(c.partial, p...)
+	for {
+		i := bytes.IndexByte(c.partial, '\n')
+		if i < 0 {
+			break
+		}
+		c.line(string(c.partial[:i]))
+		c.partial = c.partial[i+1:]
+	}
+	if len(c.partial) > maxLogLine {
+		c.flush()
+	}
+	return len(p), nil
+}
+
+func (c *logCounter) flush() {
+	if len(c.partial) > 0 {
+		c.line(string(c.partial))
+		c.partial = nil
+	}
+}
+
+func (c *logCounter) line(line string) {
+	// lines are timestamped, those logged after until are left for the next run
+	var logged time.Time
+	if i := strings.IndexByte(line, ' '); i > 0 {
+		if ts, err := time.Parse(time.RFC3339Nano, line[:i]); err == nil {
+			if !ts.Before(c.until) {
+				return
+			}
+			logged, line = ts, line[i+1:]
+		}
+	}
+	c.lines++
+	matched := ""
+	for _, p := range logPatterns {
+		if p.pattern.MatchString(line) {
+			c.counts[p.name]++
+			if matched == "" {
+				matched = p.name
+			}
+		}
+	}
+	if matched != "" && !logged.Before(c.last.time) {
+		*c.last = logMatch{line: strings.TrimRight(line, "\r"), pattern: matched, stream: c.stream, time: logged}
+	}
+}
+
+// logsWanted selects containers by the container_logs_label argument, key or key=value
+func logsWanted(labels map[string]string) bool {
+	parts := strings.SplitN(lib.Args.ContainerLogsLabel, "=", 2)
+	val, ok := labels[parts[0]]
+	if !ok {
+		return false
+	}
+	if len(parts) == 2 {
+		return val == parts[1]
+	}
+	return val != "false"
+}
+
+// setLogPatternMetrics reports dockerContainerLogSample with the lines logged since
+// the last run matching each log pattern, per stream, and the last matching line
+func setLogPatternMetrics(ctx context.Context, cli *client.Client, entity *lib.Entity, inspect types.ContainerJSON) error {
+	if lib.Args.ContainerLogsLabel == "" || inspect.ContainerJSONBase == nil || inspect.Config == nil || !logsWanted(inspect.Config.Labels) {
+		return nil
+	}
+	until := time.Now()
+	key := "logs/" + inspect.ID
+	since, ok := lib.Checkpoint(key, until.UnixNano())
+	if !ok {
+		// first run for this container, look back one interval
+		since = until.Add(-time.Duration(lib.Args.Interval) * time.Second).UnixNano()
+	}
+
+	callCtx, cancel := lib.CallContext(ctx)
+	defer cancel()
+	body, err := cli.ContainerLogs(callCtx, inspect.ID, types.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Timestamps: true,
+		Since:      fmt.Sprintf("%d.%09d", since/int64(time.Second), since%int64(time.Second)),
+		Until:      fmt.Sprintf("%d.%09d", until.Unix(), until.Nanosecond()),
+	})
+	if err == nil {
+		last := &logMatch{}
+		stdout, stderr := newLogCounter("stdout", until, last), newLogCounter("stderr", until, last)
+		if inspect.Config.Tty {
+			// a tty has a single raw stream
+			_, err = io.Copy(stdout, body)
+		} else {
+			_, err = stdcopy.StdCopy(stdout, stderr, body)
+		}
+		body.Close()
+		stdout.flush()
+		stderr.flush()
+		if err == nil {
+			publishLogCounts(entity, inspect, since, until, stdout, stderr, last)
+			return nil
+		}
+	}
+	// read the same period again next run
+	lib.Checkpoint(key, since)
+	return lib.WrapError(callCtx, "logs", "/containers/{id}/logs", inspect.ID, err)
+}
+
+func publishLogCounts(entity *lib.Entity, inspect types.ContainerJSON, since int64, until time.Time, stdout, stderr *logCounter, last *logMatch) {
+	metricSet := lib.NewSample("dockerContainerLogSample", entity)
+	lib.SetMetric(metricSet, "hostname", lib.Hostname)
+	lib.SetMetric(metricSet, "containerId", inspect.ID)
+	lib.SetMetric(metricSet, "IDShort", shortID(inspect.ID))
+	lib.SetMetric(metricSet, "containerName", strings.TrimPrefix(inspect.Name, "/"))
+	lib.SetMetric(metricSet, "imageName", inspect.Config.Image)
+	lib.SetMetric(metricSet, "periodSeconds", float64(until.UnixNano()-since)/float64(time.Second))
+	for _, counter := range []*logCounter{stdout, stderr} {
+		lib.SetMetric(metricSet, counter.stream+".lines", counter.lines)
+		for _, p := range logPatterns {
+			lib.SetMetric(metricSet, counter.stream+"."+p.name, counter.counts[p.name])
+		}
+	}
+	for _, p := range logPatterns {
+		lib.SetMetric(metricSet, p.name, stdout.counts[p.name]+stderr.counts[p.name])
+	}
+	if last.pattern != "" {
+		// redact first, a secret cut in half would no longer be detected
+		line := lib.Redact(last.line)
+		if limit := lib.Args.LogLineLength; limit > 0 && len(line) > limit {
+			// cut at a character boundary
+			for limit > 0 && !utf8.RuneStart(line[limit]) {
+				limit--
+			}
+			line = line[:limit] + "..."
+		}
+		lib.SetMetric(metricSet, "lastMatch", line)
+		lib.SetMetric(metricSet, "lastMatchPattern", last.pattern)
+		lib.SetMetric(metricSet, "lastMatchStream", last.stream)
+	}
+}
+
+// setLogFileMetrics adds the size, rotation and growth of a container's log files to its
+// ContainerSample, a json-file log without max-size grows until the disk is full
+func setLogFileMetrics(cli *client.Client, metricSet *lib.Sample, inspect types.ContainerJSON) {
+	if inspect.ContainerJSONBase == nil || inspect.HostConfig == nil {
+		return
+	}
+	logConfig := inspect.HostConfig.LogConfig
+	defaults, ok := fileLogDrivers[logConfig.Type]
+	if !ok || !isLocalDaemon(cli) {
+		return
+	}
+
+	path := inspect.LogPath
+	if logConfig.Type == "local" && inspect.ResolvConfPath != "" {
+		// inspect has no LogPath for the local driver, it writes next to the container's other files
+		path = filepath.Join(filepath.Dir(inspect.ResolvConfPath), "local-logs", "container.log")
+	}
+	if path == "" {
+		return
+	}
+
+	maxSize, maxFile := defaults.maxSize, defaults.maxFile
+	if val, ok := logConfig.Config["max-size"]; ok {
+		maxSize = val
+	}
+	if val, ok := logConfig.Config["max-file"]; ok {
+		maxFile = val
+	}
+	lib.SetMetric(metricSet, "logDriver", logConfig.Type)
+	lib.SetMetric(metricSet, "logPath", path)
+	lib.SetMetric(metricSet, "logRotation", maxSize != "" && maxSize != "-1")
+	if size, err := units.RAMInBytes(maxSize); err == nil && size > 0 {
+		lib.SetMetric(metricSet, "logMaxSizeBytes", size)
+	}
+	if files, err := strconv.Atoi(maxFile); err == nil {
+		lib.SetMetric(metricSet, "logMaxFile", files)
+	}
+
+	file, err := os.Stat(hostPath(path))
+	if err != nil {
+		// nothing logged yet, or the files are not visible from here
+		return
+	}
+	total := file.Size()
+	rotated, _ := filepath.Glob(hostPath(path) + ".*")
+	for _, name := range rotated {
+		if info, err := os.Stat(name); err == nil {
+			total += info.Size()
+		}
+	}
+	lib.SetMetric(metricSet, "logFileBytes", file.Size())
+	lib.SetMetric(metricSet, "logRotatedFiles", len(rotated))
+	lib.SetMetric(metricSet, "logTotalBytes", total)
+	if growth, ok := lib.GrowthRate("logs/"+inspect.ID, float64(total)); ok {
+		lib.SetMetric(metricSet, "logGrowthBytesPerSecond", growth)
+	}
+}
@@ -0,0 +1,222 @@
+package nrdocker
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/newrelic-experimental/nri-docker/internal/lib"
+)
+
+func TestConfigureLogPatterns(t *testing.T) {
+	defer ConfigureLogPatterns("")
+	tests := []struct {
+		patterns string
+		names    []string
+		err      bool
+	}{
+		{"", []string{"error", "exception", "panic"}, false},
+		{`{"timeout": "(?i)timed? ?out"}`, []string{"error", "exception", "panic", "timeout"}, false},
+		{`{"exception": null, "error": "ERROR"}`, []string{"error", "panic"}, false},
+		{`{"broken": "("}`, nil, true},
+		{`["error"]`, nil, true},
+	}
+	for _, tt := range tests {
+		err := ConfigureLogPatterns(tt.patterns)
+		if (err != nil) != tt.err {
+			t.Errorf("%s: error %v", tt.patterns, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		names := []string{}
+		for _, p := range logPatterns {
+			names = append(names, p.name)
+		}
+		if len(names) != len(tt.names) {
+			t.Errorf("%s: patterns %q, want %q", tt.patterns, names, tt.names)
+			continue
+		}
+		for i := range names {
+			if names[i] != tt.names[i] {
+				t.Errorf("%s: patterns %q, want %q", tt.patterns, names, tt.names)
+			}
+		}
+	}
+}
+
+func TestLogCounter(t *testing.T) {
+	if err := ConfigureLogPatterns(""); err != nil {
+		t.Fatal(err)
+	}
+	until := time.Date(2020, 9, 13, 12, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		writes []string
+		lines  int
+		counts map[string]int
+		last   string
+	}{
+		{
+			name:   "plain lines",
+			writes: []string{"starting\nERROR: connection refused\nready\n"},
+			lines:  3,
+			counts: map[string]int{"error": 1},
+			last:   "ERROR: connection refused",
+		},
+		{
+			name:   "a line split over writes",
+			writes: []string{"java.lang.NullPointer", "Exception: error reading\r\n"},
+			lines:  1,
+			counts: map[string]int{"error": 1, "exception": 1},
+			last:   "java.lang.NullPointerException: error reading",
+		},
+		{
+			name:   "words only",
+			writes: []string{"errors=0 panicked=false\n"},
+			lines:  1,
+			counts: map[string]int{},
+		},
+		{
+			name: "timestamped lines after until are left for the next run",
+			writes: []string{
+				"2020-09-13T12:29:59.5Z panic: runtime error\n",
+				"2020-09-13T12:30:00Z error: too late\n",
+			},
+			lines:  1,
+			counts: map[string]int{"error": 1, "panic": 1},
+			last:   "panic: runtime error",
+		},
+		{
+			name:   "an unterminated line is counted on flush",
+			writes: []string{"fatal error"},
+			lines:  1,
+			counts: map[string]int{"error": 1},
+			last:   "fatal error",
+		},
+	}
+	for _, tt := range tests {
+		last := &logMatch{}
+		counter := newLogCounter("stderr", until, last)
+		for _, write := range tt.writes {
+			counter.Write([]byte(write))
+		}
+		counter.flush()
+		if counter.lines != tt.lines {
+			t.Errorf("%s: %d lines, want %d", tt.name, counter.lines, tt.lines)
+		}
+		for _, p := range logPatterns {
+			if counter.counts[p.name] != tt.counts[p.name] {
+				t.Errorf("%s: %d %s lines, want %d", tt.name, counter.counts[p.name], p.name, tt.counts[p.name])
+			}
+		}
+		if last.line != tt.last || (tt.last != "" && last.stream != "stderr") {
+			t.Errorf("%s: last match %q on %s, want %q", tt.name, last.line, last.stream, tt.last)
+		}
+	}
+}
+
+func TestPublishLogCounts(t *testing.T) {
+	defer func(length int) { lib.Args.LogLineLength = length }(lib.Args.LogLineLength)
+	lib.Args.LogLineLength = 49
+	until := time.Date(2020, 9, 13, 12, 30, 0, 0, time.UTC)
+	inspect := types.ContainerJSON{ContainerJSONBase: &types.ContainerJSONBase{ID: "4fa6e0f0c678", Name: "/web"}, Config: &container.Config{Image: "web:2"}}
+	tests := []struct {
+		line string
+		want string
+	}{
+		// cut before the @, the credentials would no longer be detected
+		{"error: login failed for postgres://app:s3cr3tpassword@db:5432/orders", "error: login failed for postgres://app:[REDACTED]..."},
+		{"error: connection refused", "error: connection refused"},
+	}
+	for _, tt := range tests {
+		last := &logMatch{line: tt.line, pattern: "error", stream: "stderr", time: until}
+		entity := lib.NewPayload().LocalEntity()
+		publishLogCounts(entity, inspect, until.Add(-time.Minute).UnixNano(), until, newLogCounter("stdout", until, last), newLogCounter("stderr", until, last), last)
+		if got := entity.Samples[0].Metrics["lastMatch"]; got != tt.want {
+			t.Errorf("lastMatch %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestSetLogFileMetrics(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("log files are read on linux only")
+	}
+	defer func(root string, files bool) { lib.Args.HostRoot, lib.Args.HostFiles = root, files }(lib.Args.HostRoot, lib.Args.HostFiles)
+	lib.Args.HostRoot, lib.Args.HostFiles = t.TempDir(), true
+	containers := "/var/lib/docker/containers/4fa6e0f0c678"
+	files := map[string]int{
+		containers + "/4fa6e0f0c678-json.log":    100,
+		containers + "/4fa6e0f0c678-json.log.1":  50,
+		containers + "/local-logs/container.log": 70,
+	}
+	for name, size := range files {
+		if err := os.MkdirAll(filepath.Dir(hostPath(name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(hostPath(name), make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	local, _ := client.NewClientWithOpts(client.WithHost("unix:///var/run/docker.sock"))
+	remote, _ := client.NewClientWithOpts(client.WithHost("tcp://10.0.0.5:2376"))
+
+	tests := []struct {
+		name   string
+		cli    *client.Client
+		driver string
+		config map[string]string
+		want   map[string]interface{}
+	}{
+		{
+			name: "json-file defaults", cli: local, driver: "json-file",
+			want: map[string]interface{}{
+				"logDriver": "json-file", "logPath": containers + "/4fa6e0f0c678-json.log", "logRotation": "false", "logMaxFile": float64(1),
+				"logFileBytes": float64(100), "logRotatedFiles": float64(1), "logTotalBytes": float64(150),
+			},
+		},
+		{
+			name: "json-file with rotation", cli: local, driver: "json-file", config: map[string]string{"max-size": "10m", "max-file": "3"},
+			want: map[string]interface{}{"logRotation": "true", "logMaxSizeBytes": float64(10485760), "logMaxFile": float64(3), "logTotalBytes": float64(150)},
+		},
+		{
+			name: "json-file with an unlimited size", cli: local, driver: "json-file", config: map[string]string{"max-size": "-1"},
+			want: map[string]interface{}{"logRotation": "false", "logMaxSizeBytes": nil},
+		},
+		{
+			// no LogPath in inspect, the files are next to resolv.conf
+			name: "local defaults", cli: local, driver: "local",
+			want: map[string]interface{}{
+				"logDriver": "local", "logPath": containers + "/local-logs/container.log", "logRotation": "true",
+				"logMaxSizeBytes": float64(20971520), "logMaxFile": float64(5), "logFileBytes": float64(70), "logRotatedFiles": float64(0),
+			},
+		},
+		{name: "another driver", cli: local, driver: "syslog", want: map[string]interface{}{"logDriver": nil}},
+		{name: "a remote daemon", cli: remote, driver: "json-file", want: map[string]interface{}{"logDriver": nil}},
+	}
+	for _, tt := range tests {
+		inspect := types.ContainerJSON{ContainerJSONBase: &types.ContainerJSONBase{
+			ID:             "4fa6e0f0c678",
+			ResolvConfPath: containers + "/resolv.conf",
+			HostConfig:     &container.HostConfig{LogConfig: container.LogConfig{Type: tt.driver, Config: tt.config}},
+		}}
+		if tt.driver == "json-file" {
+			inspect.LogPath = containers + "/4fa6e0f0c678-json.log"
+		}
+		sample := lib.NewPayload().LocalEntity().NewSample("ContainerSample")
+		setLogFileMetrics(tt.cli, sample, inspect)
+		for key, val := range tt.want {
+			if sample.Metrics[key] != val {
+				t.Errorf("%s: %s = %v, want %v", tt.name, key, sample.Metrics[key], val)
+			}
+		}
+	}
+}
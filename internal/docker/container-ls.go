@@ -11,38 +11,65 @@ import (
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/client"
 	"github.com/newrelic-experimental/nri-docker/internal/lib"
-	"github.com/newrelic/infra-integrations-sdk/integration"
-	log "github.com/newrelic/infra-integrations-sdk/log"
 )
 
 // GetContainerInfo x
-func GetContainerInfo(cli *client.Client, entity *integration.Entity, i *integration.Integration) {
-	ctx := context.Background()
-	containers, err := cli.ContainerList(ctx, types.ContainerListOptions{All: true, Since: "24 hours ago"})
+func GetContainerInfo(ctx context.Context, cli *client.Client, entity *lib.Entity, payload *lib.Payload) {
+	collection := newCollectionStats()
+	callCtx, cancel := lib.CallContext(ctx)
+	containers, err := cli.ContainerList(callCtx, types.ContainerListOptions{All: true, Since: "24 hours ago"})
+	err = lib.WrapError(callCtx, "containers", "/containers/json", "", err)
+	cancel()
 	if err != nil {
-		lib.ErrorLogToInsights(err, entity)
+		lib.ReportError(entity, err)
 	}
 
+	// oom events are read once for all containers
+	ooms, err := oomEvents(ctx, cli)
+	lib.ReportError(entity, err)
+
+	workers := lib.Args.Concurrency
+	if workers <= 0 {
+		workers = 1
+	}
+	jobs := make(chan types.Container)
 	var wg sync.WaitGroup
-	wg.Add(len(containers))
-	for _, container := range containers {
-		go func(container types.Container) {
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
 			defer wg.Done()
-			FetchStats(ctx, container, cli, entity, i)
-		}(container)
+			for container := range jobs {
+				// once the run deadline passed, drain the queue so partial results get published
+				if ctx.Err() != nil {
+					collection.skip(container.ID)
+					continue
+				}
+				err := FetchStats(ctx, container, cli, entity, payload, ooms[container.ID])
+				lib.ReportError(entity, err)
+				collection.record(container.ID, err)
+			}
+		}()
+	}
+	for _, container := range containers {
+		jobs <- container
 	}
+	close(jobs)
 	wg.Wait()
+
+	collection.publish(ctx, len(containers), entity)
 }
 
 // FetchStats x
-func FetchStats(ctx context.Context, container types.Container, cli *client.Client, entity *integration.Entity, i *integration.Integration) {
-	containerEntity, _ := i.Entity(container.ID, "docker")
+func FetchStats(ctx context.Context, container types.Container, cli *client.Client, entity *lib.Entity, payload *lib.Payload, ooms int) error {
+	var failure error
+	containerEntity := payload.Entity(container.ID, "docker")
 	// containerMetricSet := lib.NewMetricSet("ContainerSample",containerEntity)
 
-	metricSet := lib.NewMetricSet("ContainerSample", containerEntity)
+	metricSet := lib.NewSample("ContainerSample", containerEntity)
 	lib.SetMetric(metricSet, "host", lib.Hostname)     // correlation purpose
 	lib.SetMetric(metricSet, "nodeName", lib.Hostname) // correlation purpose
 	lib.SetMetric(metricSet, "hostname", lib.Hostname)
+	lib.SetMetric(metricSet, "runtime", lib.Runtime)
 	lib.SetMetric(metricSet, "containerId", container.ID)
 	lib.SetMetric(metricSet, "IDShort", container.ID[0:12])
 	lib.SetMetric(metricSet, "imageName", container.Image)
@@ -55,7 +82,8 @@ func FetchStats(ctx context.Context, container types.Container, cli *client.Clie
 	lib.SetMetric(metricSet, "created", container.Created)
 	lib.SetMetric(metricSet, "duration", lib.MakeTimestamp()-(container.Created*1000))
 
-	if container.NetworkSettings.Networks != nil {
+	// Podman can leave the network settings out of the list
+	if container.NetworkSettings != nil && container.NetworkSettings.Networks != nil {
 		for i, networkSetting := range container.NetworkSettings.Networks {
 			lib.SetMetric(metricSet, "network."+i+".ipv4", networkSetting.IPAddress)
 			lib.SetMetric(metricSet, "network."+i+".gateway", networkSetting.Gateway)
@@ -85,60 +113,52 @@ func FetchStats(ctx context.Context, container types.Container, cli *client.Clie
 	lib.SetMetric(metricSet, "mounts", b.String())
 
 	//docker stats data
-	stats, err := cli.ContainerStats(ctx, container.ID, false)
-	if err != nil {
-		log.Debug(err.Error())
+	var osType string
+	var reading types.StatsJSON
+	if containerStats, streamOSType, cpu, mem, ok := streamedSnapshot(cli, container.ID); ok {
+		osType = streamOSType
+		reading = containerStats
+		setStatsMetrics(metricSet, containerStats, osType)
+		lib.SetMetric(metricSet, "statsReadings", mem.count)
+		if cpu.count > 0 {
+			lib.SetMetric(metricSet, "cpuPercentMin", cpu.min)
+			lib.SetMetric(metricSet, "cpuPercentAvg", cpu.avg())
+			lib.SetMetric(metricSet, "cpuPercentMax", cpu.max)
+		}
+		if mem.count > 0 {
+			lib.SetMetric(metricSet, "memMin", mem.min)
+			lib.SetMetric(metricSet, "memAvg", mem.avg())
+			lib.SetMetric(metricSet, "memMax", mem.max)
+		}
 	} else {
-		var containerStats types.StatsJSON
-		json.NewDecoder(stats.Body).Decode(&containerStats)
-
-		netRx, netTx, netRxErrors, netTxErrors, netRxDropped, netTxDropped, netRxPackets, netTxPackets := calculateNetwork(containerStats.Networks)
-		lib.SetMetric(metricSet, "netRx", netRx)
-		lib.SetMetric(metricSet, "netTx", netTx)
-		lib.SetMetric(metricSet, "netRxErrors", netRxErrors)
-		lib.SetMetric(metricSet, "netTxErrors", netTxErrors)
-		lib.SetMetric(metricSet, "netRxDropped", netRxDropped)
-		lib.SetMetric(metricSet, "netTxDropped", netTxDropped)
-		lib.SetMetric(metricSet, "netRxPackets", netRxPackets)
-		lib.SetMetric(metricSet, "netTxPackets", netTxPackets)
-
-		if stats.OSType == "windows" {
-			lib.SetMetric(metricSet, "cpuPercent", calculateCPUPercentWindows(containerStats))
-			lib.SetMetric(metricSet, "blkReadSizeBytes", containerStats.StorageStats.ReadSizeBytes)
-			lib.SetMetric(metricSet, "blkWriteSizeBytes", containerStats.StorageStats.WriteSizeBytes)
-			lib.SetMetric(metricSet, "mem", float64(containerStats.MemoryStats.PrivateWorkingSet))
-			lib.SetMetric(metricSet, "numProcs", containerStats.NumProcs)
-			lib.SetMetric(metricSet, "memCommitBytes", containerStats.MemoryStats.Commit)
-			lib.SetMetric(metricSet, "memCommitPeakBytes", containerStats.MemoryStats.CommitPeak)
-			lib.SetMetric(metricSet, "memPrivateWorkingSet", containerStats.MemoryStats.PrivateWorkingSet)
+		callCtx, cancel := lib.CallContext(ctx)
+		stats, err := cli.ContainerStats(callCtx, container.ID, false)
+		if err != nil {
+			failure = lib.WrapError(callCtx, "containers", "/containers/{id}/stats", container.ID, err)
 		} else {
-			lib.SetMetric(metricSet, "previousCPU", containerStats.PreCPUStats.CPUUsage.TotalUsage)
-			lib.SetMetric(metricSet, "onlineCPUs", containerStats.CPUStats.OnlineCPUs)
-			lib.SetMetric(metricSet, "systemUsage", containerStats.CPUStats.SystemUsage)
-			lib.SetMetric(metricSet, "cpuPercent", calculateCPUPercentUnix(containerStats.PreCPUStats.CPUUsage.TotalUsage, containerStats.PreCPUStats.SystemUsage, containerStats))
-			blkReadBytes, blkWriteBytes := calculateBlockIO(containerStats.BlkioStats)
-			lib.SetMetric(metricSet, "blkReadBytes", blkReadBytes)
-			lib.SetMetric(metricSet, "blkWriteBytes", blkWriteBytes)
-			mem := calculateMemUsageUnixNoCache(containerStats.MemoryStats)
-			lib.SetMetric(metricSet, "mem", mem)
-			memLimit := float64(containerStats.MemoryStats.Limit)
-			lib.SetMetric(metricSet, "memLimit", memLimit)
-			lib.SetMetric(metricSet, "memPercent", calculateMemPercentUnixNoCache(memLimit, mem))
-			lib.SetMetric(metricSet, "memUsage", float64(containerStats.MemoryStats.Usage))
-			lib.SetMetric(metricSet, "memMaxUsage", float64(containerStats.MemoryStats.MaxUsage))
-			lib.SetMetric(metricSet, "memFailCount", float64(containerStats.MemoryStats.Failcnt))
-			lib.SetMetric(metricSet, "pidsStatsCurrent", float64(containerStats.PidsStats.Current))
-			lib.SetMetric(metricSet, "pidsStatsLimit", float64(containerStats.PidsStats.Limit))
-			lib.SetMetric(metricSet, "periods", float64(containerStats.CPUStats.ThrottlingData.Periods))
-			lib.SetMetric(metricSet, "throttledPeriods", float64(containerStats.CPUStats.ThrottlingData.ThrottledPeriods))
-			lib.SetMetric(metricSet, "throttledTime", float64(containerStats.CPUStats.ThrottlingData.ThrottledTime))
+			var containerStats types.StatsJSON
+			err = json.NewDecoder(stats.Body).Decode(&containerStats)
+			stats.Body.Close()
+			if err != nil {
+				failure = lib.WrapError(callCtx, "containers", "/containers/{id}/stats", container.ID, err)
+			} else {
+				osType = stats.OSType
+				reading = containerStats
+				setStatsMetrics(metricSet, containerStats, osType)
+			}
 		}
+		cancel()
 	}
 
 	//docker inspect data
-	containerInspect, err := cli.ContainerInspect(ctx, container.ID)
+	callCtx, cancel := lib.CallContext(ctx)
+	containerInspect, err := cli.ContainerInspect(callCtx, container.ID)
+	err = lib.WrapError(callCtx, "containers", "/containers/{id}/json", container.ID, err)
+	cancel()
 	if err != nil {
-		log.Debug(err.Error())
+		if failure == nil {
+			failure = err
+		}
 	} else {
 
 		// decorate containers with additional attributes
@@ -155,11 +175,34 @@ func FetchStats(ctx context.Context, container types.Container, cli *client.Clie
 			}
 		}
 
+		setContainerInventory(containerEntity, containerInspect)
+		setContainerSecurity(containerEntity, containerInspect)
+		setLogFileMetrics(cli, metricSet, containerInspect)
+		setSocketMetrics(cli, metricSet, containerInspect)
+		setNetworkInterfaceMetrics(cli, containerEntity, containerInspect, reading.Networks)
+		pid, cgroupID, cgroupParent := 0, "", ""
+		if isLocalDaemon(cli) {
+			cgroupID = container.ID
+			if containerInspect.State != nil {
+				pid = containerInspect.State.Pid
+			}
+			if containerInspect.HostConfig != nil {
+				cgroupParent = containerInspect.HostConfig.CgroupParent
+			}
+		}
+		setBlkioMetrics(cli, containerEntity, container.ID, strings.TrimPrefix(containerInspect.Name, "/"), pid, reading.BlkioStats)
+		cgroupKills, counted := setCgroupMetrics(metricSet, pid, cgroupID, cgroupParent)
+		setOOMMetrics(metricSet, container.ID, cgroupKills, counted, ooms, containerInspect.State)
+		if err := setLogPatternMetrics(ctx, cli, containerEntity, containerInspect); err != nil && failure == nil {
+			failure = err
+		}
+		if err := setProcessMetrics(ctx, cli, metricSet, containerEntity, containerInspect); err != nil && failure == nil {
+			failure = err
+		}
+
 		lib.SetMetric(metricSet, "restartCount", containerInspect.RestartCount)
 		lib.SetMetric(metricSet, "platform", containerInspect.Platform)
 		lib.SetMetric(metricSet, "driver", containerInspect.Driver)
-		lib.SetMetric(metricSet, "nanoCPUs", containerInspect.HostConfig.NanoCPUs)
-		lib.SetMetric(metricSet, "cpuShares", containerInspect.HostConfig.CPUShares)
 
 		if containerInspect.Node != nil {
 			lib.SetMetric(metricSet, "nodeID", containerInspect.Node.ID)
@@ -171,30 +214,89 @@ func FetchStats(ctx context.Context, container types.Container, cli *client.Clie
 			}
 		}
 
-		lib.SetMetric(metricSet, "pid", containerInspect.State.Pid)
-		if containerInspect.State.Health != nil {
-			lib.SetMetric(metricSet, "failingStreak", containerInspect.State.Health.FailingStreak)
-			lib.SetMetric(metricSet, "finishedAt", containerInspect.State.FinishedAt)
+		if containerInspect.State != nil {
+			lib.SetMetric(metricSet, "pid", containerInspect.State.Pid)
+			if containerInspect.State.Health != nil {
+				lib.SetMetric(metricSet, "failingStreak", containerInspect.State.Health.FailingStreak)
+				lib.SetMetric(metricSet, "finishedAt", containerInspect.State.FinishedAt)
+			}
 		}
 
-		if stats.OSType == "windows" {
-			lib.SetMetric(metricSet, "cpuCount", containerInspect.HostConfig.CPUCount)
-			lib.SetMetric(metricSet, "ioMaximumIOps", containerInspect.HostConfig.IOMaximumIOps)
-			lib.SetMetric(metricSet, "ioMaximumBandwidth", containerInspect.HostConfig.IOMaximumBandwidth)
-			lib.SetMetric(metricSet, "isolation", containerInspect.HostConfig.Isolation)
-		} else {
-			lib.SetMetric(metricSet, "cgroupParent", containerInspect.HostConfig.CgroupParent)
-			lib.SetMetric(metricSet, "cpuPeriod", containerInspect.HostConfig.CPUPeriod)
-			lib.SetMetric(metricSet, "cpuQuota", containerInspect.HostConfig.CPUQuota)
-			lib.SetMetric(metricSet, "cpuRealtimePeriod", containerInspect.HostConfig.CPURealtimePeriod)
-			lib.SetMetric(metricSet, "CPURealtimeRuntime", containerInspect.HostConfig.CPURealtimeRuntime)
-			lib.SetMetric(metricSet, "blkioWeight", containerInspect.HostConfig.BlkioWeight)
-			// lib.SetMetric(metricSet, "diskQuota", containerInspect.HostConfig.DiskQuota)
-			lib.SetMetric(metricSet, "kernelMemory", containerInspect.HostConfig.KernelMemory)
-			lib.SetMetric(metricSet, "memoryReservation", containerInspect.HostConfig.MemoryReservation)
-			lib.SetMetric(metricSet, "memorySwap", containerInspect.HostConfig.MemorySwap)
-			lib.SetMetric(metricSet, "memorySwappiness", containerInspect.HostConfig.MemorySwappiness)
+		// Podman leaves out what it does not support
+		if containerInspect.HostConfig != nil {
+			lib.SetMetric(metricSet, "nanoCPUs", containerInspect.HostConfig.NanoCPUs)
+			lib.SetMetric(metricSet, "cpuShares", containerInspect.HostConfig.CPUShares)
+
+			if osType == "windows" {
+				lib.SetMetric(metricSet, "cpuCount", containerInspect.HostConfig.CPUCount)
+				lib.SetMetric(metricSet, "ioMaximumIOps", containerInspect.HostConfig.IOMaximumIOps)
+				lib.SetMetric(metricSet, "ioMaximumBandwidth", containerInspect.HostConfig.IOMaximumBandwidth)
+				lib.SetMetric(metricSet, "isolation", containerInspect.HostConfig.Isolation)
+			} else {
+				lib.SetMetric(metricSet, "cgroupParent", containerInspect.HostConfig.CgroupParent)
+				lib.SetMetric(metricSet, "cpuPeriod", containerInspect.HostConfig.CPUPeriod)
+				lib.SetMetric(metricSet, "cpuQuota", containerInspect.HostConfig.CPUQuota)
+				lib.SetMetric(metricSet, "cpuRealtimePeriod", containerInspect.HostConfig.CPURealtimePeriod)
+				lib.SetMetric(metricSet, "CPURealtimeRuntime", containerInspect.HostConfig.CPURealtimeRuntime)
+				lib.SetMetric(metricSet, "blkioWeight", containerInspect.HostConfig.BlkioWeight)
+				// lib.SetMetric(metricSet, "diskQuota", containerInspect.HostConfig.DiskQuota)
+				lib.SetMetric(metricSet, "kernelMemory", containerInspect.HostConfig.KernelMemory)
+				lib.SetMetric(metricSet, "memoryReservation", containerInspect.HostConfig.MemoryReservation)
+				lib.SetMetric(metricSet, "memorySwap", containerInspect.HostConfig.MemorySwap)
+				lib.SetMetric(metricSet, "memorySwappiness", containerInspect.HostConfig.MemorySwappiness)
+			}
+		}
+	}
+	return failure
+}
+
+// setStatsMetrics applies one stats reading to the container sample
+func setStatsMetrics(metricSet *lib.Sample, containerStats types.StatsJSON, osType string) {
+	netRx, netTx, netRxErrors, netTxErrors, netRxDropped, netTxDropped, netRxPackets, netTxPackets := calculateNetwork(containerStats.Networks)
+	lib.SetMetric(metricSet, "netRx", netRx)
+	lib.SetMetric(metricSet, "netTx", netTx)
+	lib.SetMetric(metricSet, "netRxErrors", netRxErrors)
+	lib.SetMetric(metricSet, "netTxErrors", netTxErrors)
+	lib.SetMetric(metricSet, "netRxDropped", netRxDropped)
+	lib.SetMetric(metricSet, "netTxDropped", netTxDropped)
+	lib.SetMetric(metricSet, "netRxPackets", netRxPackets)
+	lib.SetMetric(metricSet, "netTxPackets", netTxPackets)
+
+	if osType == "windows" {
+		lib.SetMetric(metricSet, "cpuPercent", calculateCPUPercentWindows(containerStats))
+		lib.SetMetric(metricSet, "blkReadSizeBytes", containerStats.StorageStats.ReadSizeBytes)
+		lib.SetMetric(metricSet, "blkWriteSizeBytes", containerStats.StorageStats.WriteSizeBytes)
+		lib.SetMetric(metricSet, "mem", float64(containerStats.MemoryStats.PrivateWorkingSet))
+		lib.SetMetric(metricSet, "numProcs", containerStats.NumProcs)
+		lib.SetMetric(metricSet, "memCommitBytes", containerStats.MemoryStats.Commit)
+		lib.SetMetric(metricSet, "memCommitPeakBytes", containerStats.MemoryStats.CommitPeak)
+		lib.SetMetric(metricSet, "memPrivateWorkingSet", containerStats.MemoryStats.PrivateWorkingSet)
+	} else {
+		lib.SetMetric(metricSet, "previousCPU", containerStats.PreCPUStats.CPUUsage.TotalUsage)
+		lib.SetMetric(metricSet, "onlineCPUs", containerStats.CPUStats.OnlineCPUs)
+		lib.SetMetric(metricSet, "systemUsage", containerStats.CPUStats.SystemUsage)
+		// without a previous reading, as on Podman one-shot stats or the first streamed
+		// reading, the percent would be the average since boot rather than the current usage
+		if containerStats.PreCPUStats.SystemUsage > 0 {
+			lib.SetMetric(metricSet, "cpuPercent", calculateCPUPercentUnix(containerStats.PreCPUStats.CPUUsage.TotalUsage, containerStats.PreCPUStats.SystemUsage, containerStats))
 		}
+		blkReadBytes, blkWriteBytes := calculateBlockIO(containerStats.BlkioStats)
+		lib.SetMetric(metricSet, "blkReadBytes", blkReadBytes)
+		lib.SetMetric(metricSet, "blkWriteBytes", blkWriteBytes)
+		mem := calculateMemUsageUnixNoCache(containerStats.MemoryStats)
+		lib.SetMetric(metricSet, "mem", mem)
+		memLimit := float64(containerStats.MemoryStats.Limit)
+		lib.SetMetric(metricSet, "memLimit", memLimit)
+		lib.SetMetric(metricSet, "memPercent", calculateMemPercentUnixNoCache(memLimit, mem))
+		lib.SetMetric(metricSet, "memUsage", float64(containerStats.MemoryStats.Usage))
+		lib.SetMetric(metricSet, "memMaxUsage", float64(containerStats.MemoryStats.MaxUsage))
+		lib.SetMetric(metricSet, "memFailCount", float64(containerStats.MemoryStats.Failcnt))
+		setMemoryBreakdown(metricSet, containerStats.MemoryStats.Stats)
+		lib.SetMetric(metricSet, "pidsStatsCurrent", float64(containerStats.PidsStats.Current))
+		lib.SetMetric(metricSet, "pidsStatsLimit", float64(containerStats.PidsStats.Limit))
+		lib.SetMetric(metricSet, "periods", float64(containerStats.CPUStats.ThrottlingData.Periods))
+		lib.SetMetric(metricSet, "throttledPeriods", float64(containerStats.CPUStats.ThrottlingData.ThrottledPeriods))
+		lib.SetMetric(metricSet, "throttledTime", float64(containerStats.CPUStats.ThrottlingData.ThrottledTime))
 	}
 }
 
@@ -207,8 +309,14 @@ func calculateCPUPercentUnix(previousCPU, previousSystem uint64, v types.StatsJS
 		systemDelta = float64(v.CPUStats.SystemUsage) - float64(previousSystem)
 	)
 
+	// cgroup v2 hosts and Podman leave the per cpu usage empty
+	cpus := float64(len(v.CPUStats.CPUUsage.PercpuUsage))
+	if cpus == 0 {
+		cpus = float64(v.CPUStats.OnlineCPUs)
+	}
+
 	if systemDelta > 0.0 && cpuDelta > 0.0 {
-		cpuPercent = (cpuDelta / systemDelta) * float64(len(v.CPUStats.CPUUsage.PercpuUsage)) * 100.0
+		cpuPercent = (cpuDelta / systemDelta) * cpus * 100.0
 	}
 	return cpuPercent
 }
@@ -257,10 +365,63 @@ func calculateNetwork(network map[string]types.NetworkStats) (float64, float64,
 	return rx, tx, rxErrors, txErrors, rxDropped, txDropped, rxPackets, txPackets
 }
 
-// calculateMemUsageUnixNoCache calculate memory usage of the container.
-// Page cache is intentionally excluded to avoid misinterpretation of the output.
+// calculateMemUsageUnixNoCache calculate memory usage of the container the way docker stats does.
+// Inactive page cache is intentionally excluded to avoid misinterpretation of the output.
 func calculateMemUsageUnixNoCache(mem types.MemoryStats) float64 {
-	return float64(mem.Usage - mem.Stats["cache"])
+	// cgroup v1
+	if v, ok := mem.Stats["total_inactive_file"]; ok && v < mem.Usage {
+		return float64(mem.Usage - v)
+	}
+	// cgroup v2, Podman can report more inactive file than usage, which would wrap around
+	if v := mem.Stats["inactive_file"]; v < mem.Usage {
+		return float64(mem.Usage - v)
+	}
+	return float64(mem.Usage)
+}
+
+// memoryStatKeys are the memory.stat keys of each breakdown metric, the first present is used:
+// cgroup v1 hierarchical totals, then v1 or v2 names. a+b sums two keys.
+var memoryStatKeys = []struct {
+	metric string
+	keys   []string
+}{
+	{"memRssBytes", []string{"total_rss", "rss", "anon"}},
+	{"memAnonBytes", []string{"anon", "total_active_anon+total_inactive_anon", "active_anon+inactive_anon"}},
+	{"memFileBytes", []string{"total_cache", "cache", "file"}},
+	{"memActiveFileBytes", []string{"total_active_file", "active_file"}},
+	{"memInactiveFileBytes", []string{"total_inactive_file", "inactive_file"}},
+	{"memShmemBytes", []string{"total_shmem", "shmem"}},
+	{"memMappedFileBytes", []string{"total_mapped_file", "mapped_file", "file_mapped"}},
+	{"memDirtyBytes", []string{"total_dirty", "dirty", "file_dirty"}},
+	{"memWritebackBytes", []string{"total_writeback", "writeback", "file_writeback"}},
+	// v2 has no swap in memory.stat, setCgroupMetrics reads memory.swap.current
+	{"memSwapBytes", []string{"total_swap", "swap"}},
+	{"memPageFaults", []string{"total_pgfault", "pgfault"}},
+	{"memMajorPageFaults", []string{"total_pgmajfault", "pgmajfault"}},
+}
+
+// setMemoryBreakdown reports the memory.stat breakdown under the same names on cgroup v1 and v2
+func setMemoryBreakdown(metricSet *lib.Sample, stats map[string]uint64) {
+	for _, metric := range memoryStatKeys {
+		for _, key := range metric.keys {
+			if v, ok := memoryStat(stats, key); ok {
+				lib.SetMetric(metricSet, metric.metric, v)
+				break
+			}
+		}
+	}
+}
+
+func memoryStat(stats map[string]uint64, key string) (uint64, bool) {
+	total := uint64(0)
+	for _, part := range strings.Split(key, "+") {
+		v, ok := stats[part]
+		if !ok {
+			return 0, false
+		}
+		total += v
+	}
+	return total, true
 }
 
 func calculateMemPercentUnixNoCache(limit float64, usedNoCache float64) float64 {
@@ -0,0 +1,226 @@
+package nrdocker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/newrelic-experimental/nri-docker/internal/lib"
+)
+
+// memory.stat as the stats endpoint returns it for a container on cgroup v1 and v2
+var (
+	memoryStatV1 = map[string]uint64{
+		"active_anon": 0, "active_file": 3145728, "cache": 45088768, "dirty": 8192, "hierarchical_memory_limit": 268435456,
+		"hierarchical_memsw_limit": 536870912, "inactive_anon": 94371840, "inactive_file": 41943040, "mapped_file": 12582912,
+		"pgfault": 482113, "pgmajfault": 37, "pgpgin": 145921, "pgpgout": 110873, "rss": 94371840, "rss_huge": 0, "shmem": 0,
+		"swap": 0, "unevictable": 0, "writeback": 0,
+		"total_active_anon": 2097152, "total_active_file": 3145728, "total_cache": 45088768, "total_dirty": 8192,
+		"total_inactive_anon": 94371840, "total_inactive_file": 41943040, "total_mapped_file": 12582912, "total_pgfault": 482113,
+		"total_pgmajfault": 37, "total_pgpgin": 145921, "total_pgpgout": 110873, "total_rss": 94371840, "total_rss_huge": 0,
+		"total_shmem": 0, "total_swap": 4096, "total_unevictable": 0, "total_writeback": 0,
+	}
+	memoryStatV2 = map[string]uint64{
+		"active_anon": 2097152, "active_file": 3145728, "anon": 96468992, "anon_thp": 0, "file": 45088768, "file_dirty": 8192,
+		"file_mapped": 12582912, "file_thp": 0, "file_writeback": 0, "inactive_anon": 94371840, "inactive_file": 41943040,
+		"kernel_stack": 294912, "pagetables": 1236992, "percpu": 0, "pgfault": 482113, "pgmajfault": 37, "shmem": 0,
+		"shmem_thp": 0, "slab": 2359296, "slab_reclaimable": 1572864, "slab_unreclaimable": 786432, "sock": 0,
+		"swapcached": 0, "unevictable": 0, "workingset_activate": 0, "workingset_refault": 0,
+	}
+)
+
+func TestCalculateMemUsageUnixNoCache(t *testing.T) {
+	tests := []struct {
+		name string
+		mem  types.MemoryStats
+		want float64
+	}{
+		// docker stats shows 101.9MiB
+		{"cgroup v1", types.MemoryStats{Usage: 148746240, Stats: memoryStatV1}, 106803200},
+		// docker stats shows 100MiB
+		{"cgroup v2", types.MemoryStats{Usage: 146800640, Stats: memoryStatV2}, 104857600},
+		{"more inactive file than usage on v1", types.MemoryStats{Usage: 40000000, Stats: memoryStatV1}, 40000000},
+		{"more inactive file than usage on v2", types.MemoryStats{Usage: 40000000, Stats: memoryStatV2}, 40000000},
+		{"no memory.stat", types.MemoryStats{Usage: 146800640}, 146800640},
+	}
+	for _, tt := range tests {
+		if got := calculateMemUsageUnixNoCache(tt.mem); got != tt.want {
+			t.Errorf("%s: %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSetMemoryBreakdown(t *testing.T) {
+	tests := []struct {
+		name  string
+		stats map[string]uint64
+		want  map[string]float64
+	}{
+		{
+			name:  "cgroup v1 hierarchical totals",
+			stats: memoryStatV1,
+			want: map[string]float64{
+				"memRssBytes": 94371840, "memAnonBytes": 96468992, "memFileBytes": 45088768, "memActiveFileBytes": 3145728,
+				"memInactiveFileBytes": 41943040, "memShmemBytes": 0, "memMappedFileBytes": 12582912, "memDirtyBytes": 8192,
+				"memWritebackBytes": 0, "memSwapBytes": 4096, "memPageFaults": 482113, "memMajorPageFaults": 37,
+			},
+		},
+		{
+			name: "cgroup v1 without hierarchy",
+			stats: map[string]uint64{"rss": 94371840, "cache": 45088768, "active_anon": 2097152, "inactive_anon": 94371840,
+				"mapped_file": 12582912, "swap": 0},
+			want: map[string]float64{
+				"memRssBytes": 94371840, "memAnonBytes": 96468992, "memFileBytes": 45088768, "memMappedFileBytes": 12582912,
+				"memSwapBytes": 0,
+			},
+		},
+		{
+			name:  "cgroup v2",
+			stats: memoryStatV2,
+			want: map[string]float64{
+				"memRssBytes": 96468992, "memAnonBytes": 96468992, "memFileBytes": 45088768, "memActiveFileBytes": 3145728,
+				"memInactiveFileBytes": 41943040, "memShmemBytes": 0, "memMappedFileBytes": 12582912, "memDirtyBytes": 8192,
+				"memWritebackBytes": 0, "memPageFaults": 482113, "memMajorPageFaults": 37,
+			},
+		},
+	}
+	for _, tt := range tests {
+		sample := lib.NewPayload().LocalEntity().NewSample("ContainerSample")
+		setMemoryBreakdown(sample, tt.stats)
+		if len(sample.Metrics) != len(tt.want) {
+			t.Errorf("%s: %v", tt.name, sample.Metrics)
+		}
+		for key, val := range tt.want {
+			if sample.Metrics[key] != val {
+				t.Errorf("%s: %s = %v, want %v", tt.name, key, sample.Metrics[key], val)
+			}
+		}
+	}
+}
+
+// poolDaemon lists and inspects containers and holds their stats calls back in waves of
+// inFlight calls, or for good when the container is slow, recording the most calls seen at once
+type poolDaemon struct {
+	lock       sync.Mutex
+	containers []types.Container
+	slow       string
+	inFlight   int
+	arrived    int
+	running    int
+	most       int
+}
+
+func (d *poolDaemon) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := versionPrefix.ReplaceAllString(r.URL.Path, "")
+	w.Header().Set("API-Version", "1.41")
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case path == "/containers/json":
+		json.NewEncoder(w).Encode(d.containers)
+	case path == "/events":
+	case strings.HasSuffix(path, "/json"):
+		id := strings.TrimSuffix(strings.TrimPrefix(path, "/containers/"), "/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"Id": id, "Name": "/c" + id, "State": map[string]interface{}{}, "Config": map[string]interface{}{}})
+	case strings.HasSuffix(path, "/stats"):
+		d.lock.Lock()
+		d.arrived++
+		d.running++
+		if d.running > d.most {
+			d.most = d.running
+		}
+		wave := d.arrived
+		if d.inFlight > 0 {
+			wave = ((d.arrived-1)/d.inFlight + 1) * d.inFlight
+		}
+		if wave > len(d.containers) {
+			wave = len(d.containers)
+		}
+		d.lock.Unlock()
+		if d.slow != "" && strings.Contains(path, d.slow) {
+			<-r.Context().Done()
+		}
+		for deadline := time.Now().Add(500 * time.Millisecond); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+			d.lock.Lock()
+			released := d.arrived >= wave
+			d.lock.Unlock()
+			if released {
+				break
+			}
+		}
+		json.NewEncoder(w).Encode(types.StatsJSON{})
+		d.lock.Lock()
+		d.running--
+		d.lock.Unlock()
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"message":"not found"}`))
+	}
+}
+
+func TestGetContainerInfoPool(t *testing.T) {
+	defer func(concurrency, api int) { lib.Args.Concurrency, lib.Args.APITimeout = concurrency, api }(lib.Args.Concurrency, lib.Args.APITimeout)
+	containers := []types.Container{}
+	for i := 0; i < 6; i++ {
+		containers = append(containers, types.Container{ID: fmt.Sprintf("%012d", i), State: "running"})
+	}
+	tests := []struct {
+		name        string
+		concurrency int
+		slow        string
+		runTimeout  time.Duration
+		most        int
+		want        map[string]float64
+	}{
+		{"one worker", 1, "", 0, 1, map[string]float64{"containersCollected": 6}},
+		{"no concurrency set", 0, "", 0, 1, map[string]float64{"containersCollected": 6}},
+		{"three workers", 3, "", 0, 3, map[string]float64{"containersCollected": 6}},
+		{"more workers than containers", 10, "", 0, 6, map[string]float64{"containersCollected": 6}},
+		// the api timeout ends the slow call, the rest are collected
+		{"a slow container", 3, "000000000002", 0, 0, map[string]float64{"containersCollected": 5, "containersTimedOut": 1}},
+		// the run deadline ends the slow call and skips what was still queued
+		{"the run deadline", 1, "000000000002", 2 * time.Second, 0, map[string]float64{"containersCollected": 2, "containersTimedOut": 1, "containersSkipped": 3}},
+	}
+	for _, tt := range tests {
+		daemon := &poolDaemon{containers: containers, slow: tt.slow, inFlight: tt.most}
+		server := httptest.NewServer(daemon)
+		cli, err := Endpoint{Host: "tcp://" + server.Listener.Addr().String()}.NewClient("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		lib.Args.Concurrency, lib.Args.APITimeout = tt.concurrency, 1
+		if tt.runTimeout > 0 {
+			lib.Args.APITimeout = 10
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		if tt.runTimeout > 0 {
+			ctx, cancel = context.WithTimeout(context.Background(), tt.runTimeout)
+		}
+		payload := lib.NewPayload()
+		entity := payload.LocalEntity()
+		GetContainerInfo(ctx, cli, entity, payload)
+		cancel()
+		server.Close()
+
+		// most is only known when no call is held back
+		if tt.most > 0 && daemon.most != tt.most || tt.concurrency > 0 && daemon.most > tt.concurrency {
+			t.Errorf("%s: %d stats calls at once with %d workers, want %d", tt.name, daemon.most, tt.concurrency, tt.most)
+		}
+		for _, sample := range entity.Samples {
+			if sample.Event != "dockerCollectionSample" {
+				continue
+			}
+			for _, key := range []string{"containersCollected", "containersTimedOut", "containersSkipped"} {
+				if sample.Metrics[key] != tt.want[key] {
+					t.Errorf("%s: %s = %v, want %v", tt.name, key, sample.Metrics[key], tt.want[key])
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package nrdocker
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	"github.com/newrelic-experimental/nri-docker/internal/lib"
+)
+
+// setNetworkInterfaceMetrics reports a dockerContainerNetworkSample per interface of the
+// stats reading, with the docker network the interface is attached to
+func setNetworkInterfaceMetrics(cli *client.Client, entity *lib.Entity, inspect types.ContainerJSON, interfaces map[string]types.NetworkStats) {
+	if len(interfaces) == 0 || inspect.ContainerJSONBase == nil {
+		return
+	}
+	networks := map[string]*network.EndpointSettings{}
+	if inspect.NetworkSettings != nil {
+		networks = inspect.NetworkSettings.Networks
+	}
+	names := interfaceNetworks(cli, inspect, interfaces, networks)
+
+	for iface, stats := range interfaces {
+		metricSet := lib.NewSample("dockerContainerNetworkSample", entity)
+		lib.SetMetric(metricSet, "hostname", lib.Hostname)
+		lib.SetMetric(metricSet, "containerId", inspect.ID)
+		lib.SetMetric(metricSet, "IDShort", shortID(inspect.ID))
+		lib.SetMetric(metricSet, "containerName", strings.TrimPrefix(inspect.Name, "/"))
+		lib.SetMetric(metricSet, "interface", iface)
+		if name, ok := names[iface]; ok {
+			lib.SetMetric(metricSet, "networkName", name)
+			if endpoint := networks[name]; endpoint != nil {
+				lib.SetMetric(metricSet, "networkId", endpoint.NetworkID)
+				lib.SetMetric(metricSet, "ipAddress", endpoint.IPAddress)
+				lib.SetMetric(metricSet, "macAddress", endpoint.MacAddress)
+			}
+		}
+		lib.SetMetric(metricSet, "rxBytes", stats.RxBytes)
+		lib.SetMetric(metricSet, "txBytes", stats.TxBytes)
+		lib.SetMetric(metricSet, "rxPackets", stats.RxPackets)
+		lib.SetMetric(metricSet, "txPackets", stats.TxPackets)
+		lib.SetMetric(metricSet, "rxErrors", stats.RxErrors)
+		lib.SetMetric(metricSet, "txErrors", stats.TxErrors)
+		lib.SetMetric(metricSet, "rxDropped", stats.RxDropped)
+		lib.SetMetric(metricSet, "txDropped", stats.TxDropped)
+	}
+}
+
+// interfaceNetworks maps interface names to docker network names. Stats and inspect share
+// no key, so each network's subnet is looked up in the routes of the container's network
+// namespace, and a lone interface belongs to a lone network.
+func interfaceNetworks(cli *client.Client, inspect types.ContainerJSON, interfaces map[string]types.NetworkStats, networks map[string]*network.EndpointSettings) map[string]string {
+	names := map[string]string{}
+	if inspect.State != nil && inspect.State.Pid > 0 && isLocalDaemon(cli) {
+		routes := readRoutes(hostPath(fmt.Sprintf("/proc/%d/net/route", inspect.State.Pid)))
+		for name, endpoint := range networks {
+			if endpoint == nil {
+				continue
+			}
+			ip := net.ParseIP(endpoint.IPAddress).To4()
+			if ip == nil || endpoint.IPPrefixLen <= 0 {
+				continue
+			}
+			subnet := net.IPNet{IP: ip.Mask(net.CIDRMask(endpoint.IPPrefixLen, 32)), Mask: net.CIDRMask(endpoint.IPPrefixLen, 32)}
+			if iface, ok := routes[subnet.String()]; ok {
+				names[iface] = name
+			}
+		}
+	}
+	if len(names) == 0 && len(interfaces) == 1 && len(networks) == 1 {
+		for iface := range interfaces {
+			for name := range networks {
+				names[iface] = name
+			}
+		}
+	}
+	return names
+}
+
+// readRoutes maps the destination subnets of /proc/<pid>/net/route to their interface
+func readRoutes(path string) map[string]string {
+	routes := map[string]string{}
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return routes
+	}
+	for i, line := range strings.Split(string(raw), "\n") {
+		// Iface Destination Gateway Flags RefCnt Use Metric Mask ..., addresses in little endian hex
+		fields := strings.Fields(line)
+		if i == 0 || len(fields) < 8 {
+			continue
+		}
+		destination, err := strconv.ParseUint(fields[1], 16, 32)
+		if err != nil {
+			continue
+		}
+		mask, err := strconv.ParseUint(fields[7], 16, 32)
+		if err != nil || mask == 0 {
+			// the default route says nothing about the attached subnet
+			continue
+		}
+		subnet := net.IPNet{IP: make(net.IP, 4), Mask: make(net.IPMask, 4)}
+		binary.LittleEndian.PutUint32(subnet.IP, uint32(destination))
+		binary.LittleEndian.PutUint32(subnet.Mask, uint32(mask))
+		routes[subnet.String()] = fields[0]
+	}
+	return routes
+}
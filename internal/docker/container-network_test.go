@@ -0,0 +1,92 @@
+package nrdocker
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	"github.com/newrelic-experimental/nri-docker/internal/lib"
+)
+
+const procNetRoute = `Iface	Destination	Gateway 	Flags	RefCnt	Use	Metric	Mask		MTU	Window	IRTT
+eth0	00000000	010011AC	0003	0	0	0	00000000	0	0	0
+eth0	000011AC	00000000	0001	0	0	0	0000FFFF	0	0	0
+eth1	0000A8C0	00000000	0001	0	0	0	00FFFFFF	0	0	0
+eth2	zzzzzzzz	00000000	0001	0	0	0	00FFFFFF	0	0	0
+`
+
+func TestReadRoutes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "route")
+	if err := ioutil.WriteFile(path, []byte(procNetRoute), 0644); err != nil {
+		t.Fatal(err)
+	}
+	routes := readRoutes(path)
+	want := map[string]string{"172.17.0.0/16": "eth0", "192.168.0.0/24": "eth1"}
+	if len(routes) != len(want) {
+		t.Errorf("routes %v, want %v", routes, want)
+	}
+	for subnet, iface := range want {
+		if routes[subnet] != iface {
+			t.Errorf("route to %s via %q, want %s", subnet, routes[subnet], iface)
+		}
+	}
+	if routes := readRoutes(filepath.Join(t.TempDir(), "missing")); len(routes) != 0 {
+		t.Errorf("a missing route table read as %v", routes)
+	}
+}
+
+func TestInterfaceNetworks(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("routes are only read on linux")
+	}
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "proc/42/net"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "proc/42/net/route"), []byte(procNetRoute), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer func(root string, files bool) { lib.Args.HostRoot, lib.Args.HostFiles = root, files }(lib.Args.HostRoot, lib.Args.HostFiles)
+	lib.Args.HostRoot, lib.Args.HostFiles = root, true
+	local, _ := client.NewClientWithOpts(client.WithHost("unix:///var/run/docker.sock"))
+	remote, _ := client.NewClientWithOpts(client.WithHost("tcp://10.0.0.5:2376"))
+
+	bridge := &network.EndpointSettings{NetworkID: "b1", IPAddress: "172.17.0.2", IPPrefixLen: 16}
+	backend := &network.EndpointSettings{NetworkID: "n2", IPAddress: "192.168.0.7", IPPrefixLen: 24}
+	tests := []struct {
+		name       string
+		cli        *client.Client
+		pid        int
+		interfaces []string
+		networks   map[string]*network.EndpointSettings
+		want       map[string]string
+	}{
+		{"routes of a local container", local, 42, []string{"eth0", "eth1"}, map[string]*network.EndpointSettings{"bridge": bridge, "backend": backend}, map[string]string{"eth0": "bridge", "eth1": "backend"}},
+		{"a network without address", local, 42, []string{"eth0", "eth1"}, map[string]*network.EndpointSettings{"bridge": bridge, "none": {}}, map[string]string{"eth0": "bridge"}},
+		{"a lone interface on a remote daemon", remote, 42, []string{"eth0"}, map[string]*network.EndpointSettings{"backend": backend}, map[string]string{"eth0": "backend"}},
+		{"several interfaces on a remote daemon", remote, 42, []string{"eth0", "eth1"}, map[string]*network.EndpointSettings{"bridge": bridge, "backend": backend}, map[string]string{}},
+		{"a stopped container", local, 0, []string{"eth0", "eth1"}, map[string]*network.EndpointSettings{"bridge": bridge, "backend": backend}, map[string]string{}},
+	}
+	for _, tt := range tests {
+		inspect := types.ContainerJSON{ContainerJSONBase: &types.ContainerJSONBase{State: &types.ContainerState{Pid: tt.pid}}}
+		interfaces := map[string]types.NetworkStats{}
+		for _, iface := range tt.interfaces {
+			interfaces[iface] = types.NetworkStats{}
+		}
+		names := interfaceNetworks(tt.cli, inspect, interfaces, tt.networks)
+		if len(names) != len(tt.want) {
+			t.Errorf("%s: %v, want %v", tt.name, names, tt.want)
+			continue
+		}
+		for iface, name := range tt.want {
+			if names[iface] != name {
+				t.Errorf("%s: %v, want %v", tt.name, names, tt.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package nrdocker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+	"github.com/newrelic-experimental/nri-docker/internal/lib"
+)
+
+// oomEvents counts the oom events of each container the daemon reported since the previous run
+func oomEvents(ctx context.Context, cli *client.Client) (map[string]int, error) {
+	counts := map[string]int{}
+	until := daemonNow(ctx, cli)
+	key := "oomEvents/" + cli.DaemonHost()
+	since, ok := lib.Checkpoint(key, until.UnixNano())
+	if !ok {
+		// first run for this daemon, look back one interval
+		since = until.Add(-time.Duration(lib.Args.Interval) * time.Second).UnixNano()
+	}
+
+	callCtx, cancel := lib.CallContext(ctx)
+	defer cancel()
+	messages, errs := cli.Events(callCtx, types.EventsOptions{
+		Since:   fmt.Sprintf("%d.%09d", since/int64(time.Second), since%int64(time.Second)),
+		Until:   fmt.Sprintf("%d.%09d", until.Unix(), until.Nanosecond()),
+		Filters: filters.NewArgs(filters.Arg("type", "container"), filters.Arg("event", "oom")),
+	})
+	for {
+		select {
+		case message := <-messages:
+			id := message.Actor.ID
+			if id == "" {
+				id = message.ID
+			}
+			counts[id]++
+		case err := <-errs:
+			// the stream ends with io.EOF once until is reached
+			if err == io.EOF {
+				return counts, nil
+			}
+			// read the same period again next run
+			lib.Checkpoint(key, since)
+			return counts, lib.WrapError(callCtx, "containers", "/events", "", err)
+		}
+	}
+}
+
+// daemonNow is the time on the daemon's clock, falling back to the local one. The events
+// stream stays open until the daemon's clock reaches until, a remote daemon running behind
+// would otherwise hold the call until the api timeout.
+func daemonNow(ctx context.Context, cli *client.Client) time.Time {
+	callCtx, cancel := lib.CallContext(ctx)
+	defer cancel()
+	if info, err := getDaemonInfo(callCtx, cli); err == nil {
+		if now, err := time.Parse(time.RFC3339Nano, info.SystemTime); err == nil {
+			return now
+		}
+	}
+	return time.Now()
+}
+
+// setOOMMetrics reports the oom kills of a container since the previous run and in total.
+// The cgroup counter also sees kills of child processes but is lost with the cgroup when
+// the container itself is killed, the daemon's oom events and a last exit by oom kill
+// cover that. They describe the same kills, so the largest of them is counted. The cgroup
+// counter and the last exit are baselined when first seen, kills from before that are
+// history rather than new.
+func setOOMMetrics(metricSet *lib.Sample, id string, cgroupKills float64, counted bool, events int, state *types.ContainerState) {
+	kills := float64(events)
+	if counted {
+		if increase := lib.Increase("oom/"+id+"/cgroup", cgroupKills); increase > kills {
+			kills = increase
+		}
+	}
+	if state != nil {
+		lib.SetMetric(metricSet, "oomKilled", state.OOMKilled)
+		if finished, err := time.Parse(time.RFC3339Nano, state.FinishedAt); err == nil && state.OOMKilled && !finished.IsZero() {
+			// a later exit than the one seen before
+			if lib.Increase("oom/"+id+"/exit", float64(finished.Unix())) > 0 && kills < 1 {
+				kills = 1
+			}
+		}
+	}
+	lib.SetMetric(metricSet, "oomEvents", events)
+	lib.SetMetric(metricSet, "oomKills", kills)
+	lib.SetMetric(metricSet, "oomKillsTotal", lib.Accumulate("oom/"+id+"/total", kills))
+}
@@ -0,0 +1,90 @@
+package nrdocker
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+	"github.com/newrelic-experimental/nri-docker/internal/lib"
+)
+
+func TestSetOOMMetrics(t *testing.T) {
+	oomKilled := &types.ContainerState{OOMKilled: true, FinishedAt: "2020-09-13T12:26:40Z"}
+	steps := []struct {
+		name        string
+		cgroupKills float64
+		counted     bool
+		events      int
+		state       *types.ContainerState
+		kills       float64
+		total       float64
+	}{
+		{"first sight of a container killed before", 3, true, 0, oomKilled, 0, 0},
+		{"nothing new", 3, true, 0, oomKilled, 0, 0},
+		{"a child process killed", 4, true, 0, oomKilled, 1, 1},
+		{"one kill seen by the daemon and the cgroup", 5, true, 1, oomKilled, 1, 2},
+		{"the container killed, its cgroup gone", 0, false, 1, &types.ContainerState{OOMKilled: true, FinishedAt: "2020-09-13T12:30:00Z"}, 1, 3},
+		{"a new exit without daemon event", 0, false, 0, &types.ContainerState{OOMKilled: true, FinishedAt: "2020-09-13T12:40:00Z"}, 1, 4},
+	}
+	for _, step := range steps {
+		metricSet := lib.NewPayload().Entity("web", "docker").NewSample("ContainerSample")
+		setOOMMetrics(metricSet, "oom-test", step.cgroupKills, step.counted, step.events, step.state)
+		if metricSet.Metrics["oomKills"] != step.kills || metricSet.Metrics["oomKillsTotal"] != step.total {
+			t.Errorf("%s: oomKills %v and oomKillsTotal %v, want %v and %v", step.name, metricSet.Metrics["oomKills"], metricSet.Metrics["oomKillsTotal"], step.kills, step.total)
+		}
+	}
+}
+
+// laggingDaemon has a clock behind the local one and, like dockerd, keeps the events stream
+// open until its clock reaches until
+type laggingDaemon struct {
+	now time.Time
+}
+
+func (d *laggingDaemon) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := versionPrefix.ReplaceAllString(r.URL.Path, "")
+	w.Header().Set("API-Version", "1.41")
+	w.Header().Set("Content-Type", "application/json")
+	switch path {
+	case "/info":
+		json.NewEncoder(w).Encode(map[string]string{"SystemTime": d.now.Format(time.RFC3339Nano)})
+	case "/events":
+		until, _ := strconv.ParseFloat(r.URL.Query().Get("until"), 64)
+		json.NewEncoder(w).Encode(events.Message{Type: "container", Action: "oom", Actor: events.Actor{ID: "web"}})
+		w.(http.Flusher).Flush()
+		if time.Unix(int64(until), 0).After(d.now) {
+			<-r.Context().Done()
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestOOMEventsDaemonClock(t *testing.T) {
+	defer func(api int) { lib.Args.APITimeout = api }(lib.Args.APITimeout)
+	lib.Args.APITimeout = 5
+	server := httptest.NewServer(&laggingDaemon{now: time.Now().Add(-time.Hour)})
+	defer server.Close()
+	cli, err := Endpoint{Host: "tcp://" + server.Listener.Addr().String()}.NewClient("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	counts, err := oomEvents(context.Background(), cli)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts["web"] != 1 {
+		t.Errorf("oom events %v", counts)
+	}
+	if took := time.Since(start); took > 2*time.Second {
+		t.Errorf("took %v, read past the daemon's clock", took)
+	}
+}
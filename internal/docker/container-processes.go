@@ -0,0 +1,159 @@
+package nrdocker
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/newrelic-experimental/nri-docker/internal/lib"
+)
+
+// psArgs asks dockerd's ps for the columns reported, engines that reject them get their default columns
+var psArgs = []string{"-eo", "pid,ppid,user,stat,pcpu,rss,nlwp,args"}
+
+// process is one row of ContainerTop, completed from /proc when it is readable
+type process struct {
+	pid        int
+	ppid       int
+	user       string
+	state      string
+	cpuPercent float64
+	rssBytes   uint64
+	threads    int
+	command    string
+}
+
+// setProcessMetrics reports a dockerContainerProcessSample per process of a running container,
+// the busiest first up to max_processes, and process, thread and zombie counts on its ContainerSample
+func setProcessMetrics(ctx context.Context, cli *client.Client, metricSet *lib.Sample, entity *lib.Entity, inspect types.ContainerJSON) error {
+	if !lib.Args.ContainerProcesses || inspect.ContainerJSONBase == nil || inspect.State == nil || !inspect.State.Running {
+		return nil
+	}
+	callCtx, cancel := lib.CallContext(ctx)
+	top, err := cli.ContainerTop(callCtx, inspect.ID, psArgs)
+	if err != nil && callCtx.Err() == nil {
+		// podman and windows engines take no ps arguments
+		top, err = cli.ContainerTop(callCtx, inspect.ID, nil)
+	}
+	err = lib.WrapError(callCtx, "processes", "/containers/{id}/top", inspect.ID, err)
+	cancel()
+	if err != nil {
+		return err
+	}
+
+	local := isLocalDaemon(cli)
+	processes := parseTop(top.Titles, top.Processes)
+	threads, zombies := 0, 0
+	for i := range processes {
+		if local {
+			readProcStatus(&processes[i])
+		}
+		threads += processes[i].threads
+		if strings.HasPrefix(processes[i].state, "Z") {
+			zombies++
+		}
+	}
+	lib.SetMetric(metricSet, "processCount", len(processes))
+	lib.SetMetric(metricSet, "threadCount", threads)
+	lib.SetMetric(metricSet, "zombieProcesses", zombies)
+
+	sort.SliceStable(processes, func(i, j int) bool { return processes[i].cpuPercent > processes[j].cpuPercent })
+	for i, p := range processes {
+		if lib.Args.MaxProcesses > 0 && i >= lib.Args.MaxProcesses {
+			break
+		}
+		processSet := lib.NewSample("dockerContainerProcessSample", entity)
+		lib.SetMetric(processSet, "hostname", lib.Hostname)
+		lib.SetMetric(processSet, "containerId", inspect.ID)
+		lib.SetMetric(processSet, "IDShort", shortID(inspect.ID))
+		lib.SetMetric(processSet, "containerName", strings.TrimPrefix(inspect.Name, "/"))
+		lib.SetMetric(processSet, "pid", p.pid)
+		lib.SetMetric(processSet, "ppid", p.ppid)
+		lib.SetMetric(processSet, "user", p.user)
+		lib.SetMetric(processSet, "state", p.state)
+		lib.SetMetric(processSet, "zombie", strings.HasPrefix(p.state, "Z"))
+		lib.SetMetric(processSet, "cpuPercent", p.cpuPercent)
+		lib.SetMetric(processSet, "rssBytes", p.rssBytes)
+		lib.SetMetric(processSet, "threads", p.threads)
+		lib.SetMetric(processSet, "command", p.command)
+	}
+	return nil
+}
+
+// parseTop maps the ps columns by title, ps -ef and podman name them differently
+func parseTop(titles []string, rows [][]string) []process {
+	processes := []process{}
+	for _, row := range rows {
+		p := process{threads: 1}
+		for i, title := range titles {
+			if i >= len(row) {
+				break
+			}
+			val := strings.TrimSpace(row[i])
+			switch strings.ToUpper(title) {
+			case "PID":
+				p.pid, _ = strconv.Atoi(val)
+			case "PPID":
+				p.ppid, _ = strconv.Atoi(val)
+			case "USER", "UID":
+				p.user = val
+			case "STAT", "S", "STATE":
+				p.state = val
+			case "%CPU", "C":
+				p.cpuPercent, _ = strconv.ParseFloat(val, 64)
+			case "RSS":
+				// KiB
+				rss, _ := strconv.ParseUint(val, 10, 64)
+				p.rssBytes = rss * 1024
+			case "NLWP", "THCNT":
+				if threads, err := strconv.Atoi(val); err == nil {
+					p.threads = threads
+				}
+			case "COMMAND", "CMD", "ARGS":
+				p.command = val
+			}
+		}
+		if p.state == "" && strings.HasSuffix(p.command, "<defunct>") {
+			p.state = "Z"
+		}
+		processes = append(processes, p)
+	}
+	return processes
+}
+
+// readProcStatus takes state, threads, rss and ppid from /proc/<pid>/status, exact where ps columns may be missing
+func readProcStatus(p *process) {
+	if p.pid <= 0 {
+		return
+	}
+	raw, err := ioutil.ReadFile(hostPath(fmt.Sprintf("/proc/%d/status", p.pid)))
+	if err != nil {
+		return
+	}
+	for _, line := range strings.Split(string(raw), "\n") {
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		fields := strings.Fields(parts[1])
+		if len(fields) == 0 {
+			continue
+		}
+		switch parts[0] {
+		case "State":
+			p.state = fields[0]
+		case "Threads":
+			p.threads, _ = strconv.Atoi(fields[0])
+		case "PPid":
+			p.ppid, _ = strconv.Atoi(fields[0])
+		case "VmRSS":
+			rss, _ := strconv.ParseUint(fields[0], 10, 64)
+			p.rssBytes = rss * 1024
+		}
+	}
+}
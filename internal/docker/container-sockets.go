@@ -0,0 +1,154 @@
+package nrdocker
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/newrelic-experimental/nri-docker/internal/lib"
+)
+
+// tcpStates are the kernel's TCP states in /proc/net/tcp, include/net/tcp_states.h
+var tcpStates = map[string]string{
+	"01": "established",
+	"02": "synSent",
+	"03": "synRecv",
+	"04": "finWait1",
+	"05": "finWait2",
+	"06": "timeWait",
+	"07": "close",
+	"08": "closeWait",
+	"09": "lastAck",
+	"0A": "listen",
+	"0B": "closing",
+}
+
+// setSocketMetrics adds the open file descriptors of a container's main process against
+// its RLIMIT_NOFILE, and the TCP connections by state and listening ports of its network
+// namespace, read through the host's /proc, to its ContainerSample
+func setSocketMetrics(cli *client.Client, metricSet *lib.Sample, inspect types.ContainerJSON) {
+	if inspect.ContainerJSONBase == nil || inspect.State == nil || !inspect.State.Running || inspect.State.Pid <= 0 || !isLocalDaemon(cli) {
+		return
+	}
+	proc := hostPath(fmt.Sprintf("/proc/%d", inspect.State.Pid))
+
+	if fds, err := ioutil.ReadDir(proc + "/fd"); err == nil {
+		lib.SetMetric(metricSet, "fdOpen", len(fds))
+		if soft, hard, ok := openFilesLimit(proc + "/limits"); ok {
+			lib.SetMetric(metricSet, "fdLimitSoft", soft)
+			lib.SetMetric(metricSet, "fdLimitHard", hard)
+			if soft > 0 {
+				lib.SetMetric(metricSet, "fdUsedPercent", float64(len(fds))/float64(soft)*100)
+			}
+		}
+	}
+
+	states := map[string]int{}
+	listening := map[string]bool{}
+	connections, udpSockets, readable := 0, 0, false
+	for _, table := range []string{"tcp", "tcp6"} {
+		sockets, ok := readSocketTable(proc + "/net/" + table)
+		readable = readable || ok
+		for _, socket := range sockets {
+			state, ok := tcpStates[socket.state]
+			if !ok {
+				continue
+			}
+			states[state]++
+			if state == "listen" {
+				listening["tcp:"+strconv.Itoa(socket.localPort)] = true
+			} else {
+				connections++
+			}
+		}
+	}
+	for _, table := range []string{"udp", "udp6"} {
+		sockets, ok := readSocketTable(proc + "/net/" + table)
+		readable = readable || ok
+		for _, socket := range sockets {
+			udpSockets++
+			// an unconnected udp socket receives from anyone on its port
+			if socket.remotePort == 0 && socket.localPort > 0 {
+				listening["udp:"+strconv.Itoa(socket.localPort)] = true
+			}
+		}
+	}
+	if !readable {
+		return
+	}
+	for _, state := range tcpStates {
+		lib.SetMetric(metricSet, "tcp."+state, states[state])
+	}
+	lib.SetMetric(metricSet, "tcpConnections", connections)
+	lib.SetMetric(metricSet, "udpSockets", udpSockets)
+	ports := []string{}
+	for port := range listening {
+		ports = append(ports, port)
+	}
+	sort.Strings(ports)
+	lib.SetMetric(metricSet, "listeningPorts", strings.Join(ports, ","))
+	lib.SetMetric(metricSet, "listeningPortCount", len(ports))
+}
+
+// openFilesLimit reads the "Max open files" row of /proc/<pid>/limits, unlimited reads as 0
+func openFilesLimit(path string) (uint64, uint64, bool) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, 0, false
+	}
+	for _, line := range strings.Split(string(raw), "\n") {
+		if !strings.HasPrefix(line, "Max open files") {
+			continue
+		}
+		fields := strings.Fields(strings.TrimPrefix(line, "Max open files"))
+		if len(fields) < 2 {
+			return 0, 0, false
+		}
+		soft, _ := strconv.ParseUint(fields[0], 10, 64)
+		hard, _ := strconv.ParseUint(fields[1], 10, 64)
+		return soft, hard, true
+	}
+	return 0, 0, false
+}
+
+// socketEntry is a row of /proc/<pid>/net/{tcp,udp}{,6}
+type socketEntry struct {
+	localPort  int
+	remotePort int
+	state      string
+}
+
+func readSocketTable(path string) ([]socketEntry, bool) {
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	sockets := []socketEntry{}
+	for i, line := range strings.Split(string(raw), "\n") {
+		fields := strings.Fields(line)
+		// the first line holds the column titles
+		if i == 0 || len(fields) < 4 {
+			continue
+		}
+		sockets = append(sockets, socketEntry{
+			localPort:  hexPort(fields[1]),
+			remotePort: hexPort(fields[2]),
+			state:      fields[3],
+		})
+	}
+	return sockets, true
+}
+
+// hexPort reads the port of an address such as 0100007F:1F90
+func hexPort(address string) int {
+	i := strings.LastIndex(address, ":")
+	if i < 0 {
+		return 0
+	}
+	port, _ := strconv.ParseUint(address[i+1:], 16, 16)
+	return int(port)
+}
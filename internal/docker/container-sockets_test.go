@@ -0,0 +1,88 @@
+package nrdocker
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+const procNetTCP = `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000:1F90 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 20301 1 0000000000000000 100 0 0 10 0
+   1: 0100007F:1F90 0100007F:C350 01 00000000:00000000 00:00000000 00000000     0        0 20302 1 0000000000000000 20 4 30 10 -1
+   2: 0200000A:A0C2 0500000A:0CEA 06 00000000:00000000 03:00000A3E 00000000     0        0 0 3 0000000000000000
+`
+
+func TestReadSocketTable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tcp")
+	if err := ioutil.WriteFile(path, []byte(procNetTCP), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sockets, ok := readSocketTable(path)
+	if !ok {
+		t.Fatal("table not read")
+	}
+	want := []struct {
+		socketEntry
+		state string
+	}{
+		{socketEntry{localPort: 8080, remotePort: 0, state: "0A"}, "listen"},
+		{socketEntry{localPort: 8080, remotePort: 50000, state: "01"}, "established"},
+		{socketEntry{localPort: 41154, remotePort: 3306, state: "06"}, "timeWait"},
+	}
+	if len(sockets) != len(want) {
+		t.Fatalf("%d sockets, want %d", len(sockets), len(want))
+	}
+	for i, w := range want {
+		if sockets[i] != w.socketEntry {
+			t.Errorf("socket %d is %+v, want %+v", i, sockets[i], w.socketEntry)
+		}
+		if tcpStates[sockets[i].state] != w.state {
+			t.Errorf("socket %d state %s, want %s", i, tcpStates[sockets[i].state], w.state)
+		}
+	}
+
+	if _, ok := readSocketTable(filepath.Join(t.TempDir(), "missing")); ok {
+		t.Error("a missing table read")
+	}
+}
+
+func TestHexPort(t *testing.T) {
+	tests := []struct {
+		address string
+		port    int
+	}{
+		{"0100007F:1F90", 8080},
+		{"00000000000000000000000001000000:0050", 80},
+		{"00000000:0000", 0},
+		{"0100007F", 0},
+		{"0100007F:ZZZZ", 0},
+	}
+	for _, tt := range tests {
+		if got := hexPort(tt.address); got != tt.port {
+			t.Errorf("hexPort(%q) = %d, want %d", tt.address, got, tt.port)
+		}
+	}
+}
+
+func TestOpenFilesLimit(t *testing.T) {
+	tests := []struct {
+		limits string
+		soft   uint64
+		hard   uint64
+		ok     bool
+	}{
+		{"Limit                     Soft Limit           Hard Limit           Units\nMax open files            1024                 1048576              files\n", 1024, 1048576, true},
+		{"Max open files            unlimited            unlimited            files\n", 0, 0, true},
+		{"Max processes             63704                63704                processes\n", 0, 0, false},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "limits")
+		if err := ioutil.WriteFile(path, []byte(tt.limits), 0644); err != nil {
+			t.Fatal(err)
+		}
+		soft, hard, ok := openFilesLimit(path)
+		if soft != tt.soft || hard != tt.hard || ok != tt.ok {
+			t.Errorf("%q: %d %d %v, want %d %d %v", tt.limits, soft, hard, ok, tt.soft, tt.hard, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,292 @@
+package nrdocker
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/newrelic-experimental/nri-docker/internal/lib"
+	"github.com/newrelic-experimental/nri-docker/internal/rpc"
+)
+
+// containerd services called, requests are empty or filter only messages
+const (
+	containerdVersion    = "/containerd.services.version.v1.Version/Version"
+	containerdNamespaces = "/containerd.services.namespaces.v1.Namespaces/List"
+	containerdContainers = "/containerd.services.containers.v1.Containers/List"
+	containerdTasks      = "/containerd.services.tasks.v1.Tasks/List"
+)
+
+// the namespace dockerd keeps its containers in, they are collected through the docker API
+const mobyNamespace = "moby"
+
+// containerd task states, containerd.v1.types.Status
+var taskStates = map[uint64]string{1: "created", 2: "running", 3: "exited", 4: "paused", 5: "paused"}
+
+// Containerd is a client for the containerd API on its unix socket
+type Containerd struct {
+	Socket string
+	rpc    *rpc.Client
+}
+
+// containerdContainer is a container together with its task, Pid is 0 without a running task
+type containerdContainer struct {
+	Namespace string
+	ID        string
+	Image     string
+	Runtime   string
+	Labels    map[string]string
+	Created   int64
+	State     string
+	Pid       int
+}
+
+// NewContainerd creates a client for the containerd socket at path
+func NewContainerd(path string) *Containerd {
+	return &Containerd{
+		Socket: path,
+		rpc: rpc.NewDialerClient(func(network, addr string) (net.Conn, error) {
+			return net.Dial("unix", path)
+		}),
+	}
+}
+
+// invoke calls method in namespace and records it like the docker API calls
+func (c *Containerd) invoke(ctx context.Context, method, namespace string) (rpc.Message, error) {
+	metadata := map[string]string{}
+	if namespace != "" {
+		metadata["containerd-namespace"] = namespace
+	}
+	start := time.Now()
+	response, err := c.rpc.Invoke(ctx, method, []byte{}, metadata)
+	lib.Self.ObserveCall(method, time.Since(start), err != nil)
+	if err != nil {
+		return nil, err
+	}
+	return rpc.Parse(response)
+}
+
+// Version returns the containerd version
+func (c *Containerd) Version(ctx context.Context) (string, error) {
+	response, err := c.invoke(ctx, containerdVersion, "")
+	if err != nil {
+		return "", err
+	}
+	return response.String(1), nil
+}
+
+// Namespaces lists the namespace names
+func (c *Containerd) Namespaces(ctx context.Context) ([]string, error) {
+	response, err := c.invoke(ctx, containerdNamespaces, "")
+	if err != nil {
+		return nil, err
+	}
+	namespaces, err := response.Messages(1)
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, namespace := range namespaces {
+		names = append(names, namespace.String(1))
+	}
+	return names, nil
+}
+
+// Containers lists the containers of namespace joined with their tasks
+func (c *Containerd) Containers(ctx context.Context, namespace string) ([]containerdContainer, error) {
+	response, err := c.invoke(ctx, containerdContainers, namespace)
+	if err != nil {
+		return nil, err
+	}
+	containers, err := response.Messages(1)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err = c.invoke(ctx, containerdTasks, namespace)
+	if err != nil {
+		return nil, err
+	}
+	tasks, err := response.Messages(1)
+	if err != nil {
+		return nil, err
+	}
+	byContainer := map[string]rpc.Message{}
+	for _, task := range tasks {
+		byContainer[task.String(1)] = task
+	}
+
+	result := []containerdContainer{}
+	for _, container := range containers {
+		labels, err := container.Map(2)
+		if err != nil {
+			return nil, err
+		}
+		runtime, err := container.Message(4)
+		if err != nil {
+			return nil, err
+		}
+		created, err := container.Message(8)
+		if err != nil {
+			return nil, err
+		}
+		cc := containerdContainer{
+			Namespace: namespace,
+			ID:        container.String(1),
+			Labels:    labels,
+			Image:     container.String(3),
+			Runtime:   runtime.String(1),
+			Created:   int64(created.Uint(1)),
+			// without a task the container was never started or its task was cleaned up
+			State: "created",
+		}
+		if task, ok := byContainer[cc.ID]; ok {
+			// containerd.v1.types.Process: container_id 1, pid 3, status 4
+			cc.Pid = int(task.Uint(3))
+			cc.State = taskStates[task.Uint(4)]
+		}
+		result = append(result, cc)
+	}
+	return result, nil
+}
+
+// GetContainerdInfo reports the containers of a containerd host with the same
+// ContainerSample schema FetchStats produces, metrics are read from cgroups
+func GetContainerdInfo(ctx context.Context, cd *Containerd, entity *lib.Entity, payload *lib.Payload) {
+	lib.Runtime = "containerd"
+	lib.CgroupDriver = ""
+	collection := newCollectionStats()
+	callCtx, cancel := lib.CallContext(ctx)
+	version, err := cd.Version(callCtx)
+	err = lib.WrapError(callCtx, "containerd", containerdVersion, "", err)
+	cancel()
+	if err != nil {
+		// nothing else will answer either
+		lib.ReportError(entity, err)
+		return
+	}
+
+	callCtx, cancel = lib.CallContext(ctx)
+	namespaces, err := cd.Namespaces(callCtx)
+	err = lib.WrapError(callCtx, "containerd", containerdNamespaces, "", err)
+	cancel()
+	if err != nil {
+		lib.ReportError(entity, err)
+		return
+	}
+
+	containers := []containerdContainer{}
+	for _, namespace := range namespaces {
+		if !containerdNamespaceWanted(namespace) {
+			continue
+		}
+		callCtx, cancel := lib.CallContext(ctx)
+		found, err := cd.Containers(callCtx, namespace)
+		err = lib.WrapError(callCtx, "containerd", containerdContainers, "", err)
+		cancel()
+		if err != nil {
+			lib.ReportError(entity, err)
+			continue
+		}
+		containers = append(containers, found...)
+	}
+
+	infoSample := lib.NewSample("dockerInfoSample", entity)
+	lib.SetMetric(infoSample, "runtime", "containerd")
+	lib.SetMetric(infoSample, "runtimeVersion", version)
+	lib.SetMetric(infoSample, "serverVersion", version)
+	lib.SetMetric(infoSample, "daemonHost", "unix://"+cd.Socket)
+	lib.SetMetric(infoSample, "host", lib.Hostname)
+	lib.SetMetric(infoSample, "namespaces", len(namespaces))
+	states := map[string]int{}
+	for _, container := range containers {
+		states[container.State]++
+	}
+	lib.SetMetric(infoSample, "containers", len(containers))
+	lib.SetMetric(infoSample, "containersRunning", states["running"])
+	lib.SetMetric(infoSample, "containersPaused", states["paused"])
+	lib.SetMetric(infoSample, "containersStopped", states["exited"]+states["created"])
+
+	// cpu percent needs two readings, both are taken for every container at once
+	first := map[string]types.StatsJSON{}
+	for _, container := range containers {
+		if container.Pid > 0 {
+			if stats, err := cgroupStats(container.Pid); err == nil {
+				first[container.ID] = stats
+			}
+		}
+	}
+	if len(first) > 0 {
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Second):
+		}
+	}
+
+	for _, container := range containers {
+		if ctx.Err() != nil {
+			collection.skip(container.ID)
+			continue
+		}
+		err := fetchContainerdStats(container, first, payload)
+		lib.ReportError(entity, err)
+		collection.record(container.ID, err)
+	}
+	collection.publish(ctx, len(containers), entity)
+}
+
+func containerdNamespaceWanted(namespace string) bool {
+	if lib.Args.ContainerdNamespaces == "" {
+		return namespace != mobyNamespace
+	}
+	for _, wanted := range strings.Split(lib.Args.ContainerdNamespaces, ",") {
+		if strings.TrimSpace(wanted) == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+func fetchContainerdStats(container containerdContainer, first map[string]types.StatsJSON, payload *lib.Payload) error {
+	containerEntity := payload.Entity(container.ID, "docker")
+	metricSet := lib.NewSample("ContainerSample", containerEntity)
+	lib.SetMetric(metricSet, "host", lib.Hostname)     // correlation purpose
+	lib.SetMetric(metricSet, "nodeName", lib.Hostname) // correlation purpose
+	lib.SetMetric(metricSet, "hostname", lib.Hostname)
+	lib.SetMetric(metricSet, "runtime", "containerd")
+	lib.SetMetric(metricSet, "containerdNamespace", container.Namespace)
+	lib.SetMetric(metricSet, "containerdRuntime", container.Runtime)
+	lib.SetMetric(metricSet, "containerId", container.ID)
+	lib.SetMetric(metricSet, "IDShort", shortID(container.ID))
+	lib.SetMetric(metricSet, "imageName", container.Image)
+	lib.SetMetric(metricSet, "imageShort", strings.Split(container.Image, "@")[0])
+	lib.SetMetric(metricSet, "state", container.State)
+	lib.SetMetric(metricSet, "status", container.State)
+	if container.Created > 0 {
+		lib.SetMetric(metricSet, "created", container.Created)
+		lib.SetMetric(metricSet, "duration", lib.MakeTimestamp()-(container.Created*1000))
+	}
+	for key, val := range container.Labels {
+		lib.SetMetric(metricSet, key, val)
+	}
+
+	if container.Pid == 0 {
+		return nil
+	}
+	lib.SetMetric(metricSet, "pid", container.Pid)
+	stats, err := cgroupStats(container.Pid)
+	if err != nil {
+		// the task may have exited in between
+		return lib.WrapError(nil, "containerd", "cgroup", container.ID, err)
+	}
+	if previous, ok := first[container.ID]; ok {
+		stats.PreCPUStats = previous.CPUStats
+	}
+	setStatsMetrics(metricSet, stats, "linux")
+	setBlkioMetrics(nil, containerEntity, container.ID, "", container.Pid, stats.BlkioStats)
+	cgroupKills, counted := setCgroupMetrics(metricSet, container.Pid, container.ID, "")
+	setOOMMetrics(metricSet, container.ID, cgroupKills, counted, 0, nil)
+	return nil
+}
@@ -0,0 +1,191 @@
+package nrdocker
+
+import (
+	"context"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/newrelic-experimental/nri-docker/internal/lib"
+	"github.com/newrelic-experimental/nri-docker/internal/rpc"
+	"golang.org/x/net/http2"
+)
+
+// fakeContainerd serves canned responses by method on a unix socket, the way containerd does
+func fakeContainerd(t *testing.T, responses map[string]func(namespace string) []byte) string {
+	socket := filepath.Join(t.TempDir(), "containerd.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		w.Header().Set("content-type", "application/grpc")
+		response, ok := responses[r.URL.Path]
+		if !ok {
+			w.Header().Set("grpc-status", "12")
+			w.Header().Set("grpc-message", "unknown method "+r.URL.Path)
+			return
+		}
+		message := response(r.Header.Get("containerd-namespace"))
+		frame := make([]byte, 5+len(message))
+		binary.BigEndian.PutUint32(frame[1:5], uint32(len(message)))
+		copy(frame[5:], message)
+		w.Write(frame)
+		w.Header().Set(http.TrailerPrefix+"grpc-status", "0")
+	})
+	server := &http2.Server{}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.ServeConn(conn, &http2.ServeConnOpts{Handler: handler})
+		}
+	}()
+	return socket
+}
+
+// containerdResponses has a running, a paused and a never started container in default,
+// and a container of dockerd in moby
+func containerdResponses() map[string]func(string) []byte {
+	container := func(b *rpc.Buffer, id, image string, labels map[string]string) {
+		b.Message(1, func(c *rpc.Buffer) {
+			c.String(1, id)
+			for key, val := range labels {
+				c.Message(2, func(entry *rpc.Buffer) {
+					entry.String(1, key)
+					entry.String(2, val)
+				})
+			}
+			c.String(3, image)
+			c.Message(4, func(runtime *rpc.Buffer) { runtime.String(1, "io.containerd.runc.v2") })
+			c.Message(8, func(created *rpc.Buffer) { created.Varint(1, 1600000000) })
+		})
+	}
+	task := func(b *rpc.Buffer, id string, pid uint64, status uint64, terminal bool) {
+		b.Message(1, func(p *rpc.Buffer) {
+			p.String(1, id)
+			p.String(2, id)
+			p.Varint(3, pid)
+			p.Varint(4, status)
+			p.Bool(8, terminal)
+		})
+	}
+	return map[string]func(string) []byte{
+		containerdVersion: func(string) []byte {
+			b := &rpc.Buffer{}
+			b.String(1, "v1.6.20")
+			b.String(2, "2806fc1")
+			return b.Bytes()
+		},
+		containerdNamespaces: func(string) []byte {
+			b := &rpc.Buffer{}
+			for _, name := range []string{"default", "moby"} {
+				b.Message(1, func(n *rpc.Buffer) { n.String(1, name) })
+			}
+			return b.Bytes()
+		},
+		containerdContainers: func(namespace string) []byte {
+			b := &rpc.Buffer{}
+			switch namespace {
+			case "default":
+				container(b, "web", "docker.io/library/nginx:latest", map[string]string{"app": "web"})
+				container(b, "batch", "docker.io/library/busybox:latest", nil)
+				container(b, "idle", "docker.io/library/alpine:latest", nil)
+			case "moby":
+				container(b, "dockerd-owned", "docker.io/library/redis:latest", nil)
+			}
+			return b.Bytes()
+		},
+		containerdTasks: func(namespace string) []byte {
+			b := &rpc.Buffer{}
+			if namespace == "default" {
+				// a terminal task still has a status of its own
+				task(b, "web", 999999991, 2, true)
+				task(b, "batch", 999999992, 4, false)
+			}
+			return b.Bytes()
+		},
+	}
+}
+
+func TestContainerdContainers(t *testing.T) {
+	cd := NewContainerd(fakeContainerd(t, containerdResponses()))
+	ctx := context.Background()
+
+	version, err := cd.Version(ctx)
+	if err != nil || version != "v1.6.20" {
+		t.Fatalf("version %q, %v", version, err)
+	}
+	namespaces, err := cd.Namespaces(ctx)
+	if err != nil || len(namespaces) != 2 || namespaces[0] != "default" {
+		t.Fatalf("namespaces %v, %v", namespaces, err)
+	}
+
+	containers, err := cd.Containers(ctx, "default")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []containerdContainer{
+		{ID: "web", State: "running", Pid: 999999991, Image: "docker.io/library/nginx:latest"},
+		{ID: "batch", State: "paused", Pid: 999999992, Image: "docker.io/library/busybox:latest"},
+		{ID: "idle", State: "created", Pid: 0, Image: "docker.io/library/alpine:latest"},
+	}
+	if len(containers) != len(want) {
+		t.Fatalf("got %d containers, want %d", len(containers), len(want))
+	}
+	for i, c := range containers {
+		w := want[i]
+		if c.ID != w.ID || c.State != w.State || c.Pid != w.Pid || c.Image != w.Image {
+			t.Errorf("container %d is %+v, want %+v", i, c, w)
+		}
+		if c.Namespace != "default" || c.Runtime != "io.containerd.runc.v2" || c.Created != 1600000000 {
+			t.Errorf("container %s has namespace %q, runtime %q, created %d", c.ID, c.Namespace, c.Runtime, c.Created)
+		}
+	}
+	if containers[0].Labels["app"] != "web" {
+		t.Errorf("labels %v", containers[0].Labels)
+	}
+}
+
+func TestGetContainerdInfo(t *testing.T) {
+	cd := NewContainerd(fakeContainerd(t, containerdResponses()))
+	payload := lib.NewPayload()
+	entity := payload.LocalEntity()
+	GetContainerdInfo(context.Background(), cd, entity, payload)
+
+	var info *lib.Sample
+	for _, sample := range entity.Samples {
+		if sample.Event == "dockerInfoSample" {
+			info = sample
+		}
+	}
+	if info == nil {
+		t.Fatal("no dockerInfoSample")
+	}
+	// moby is left to the docker collector
+	expected := map[string]interface{}{
+		"runtimeVersion":    "v1.6.20",
+		"containers":        float64(3),
+		"containersRunning": float64(1),
+		"containersPaused":  float64(1),
+		"containersStopped": float64(1),
+	}
+	for key, val := range expected {
+		if info.Metrics[key] != val {
+			t.Errorf("%s is %v, want %v", key, info.Metrics[key], val)
+		}
+	}
+	for _, e := range payload.Entities {
+		if e.Name == "dockerd-owned" {
+			t.Error("containers of the moby namespace are collected")
+		}
+	}
+}
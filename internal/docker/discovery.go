@@ -0,0 +1,105 @@
+package nrdocker
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/newrelic-experimental/nri-docker/internal/lib"
+	log "github.com/newrelic/infra-integrations-sdk/log"
+)
+
+var rootlessSocket = regexp.MustCompile(`/run/user/([0-9]+)/docker\.sock$`)
+
+// DiscoverSockets looks for every Docker socket on the host: DOCKER_HOST, the
+// system socket and the per user sockets of rootless daemons, also below
+// HostRoot when running in a container. The first one found is the default
+// engine, the others are named after their socket.
+func DiscoverSockets() []Endpoint {
+	candidates := []string{}
+	if host := os.Getenv("DOCKER_HOST"); host != "" {
+		if !strings.HasPrefix(host, "unix://") {
+			// a tcp DOCKER_HOST cannot be checked on disk, it is the default engine as is
+			return []Endpoint{{Host: host}}
+		}
+		candidates = append(candidates, strings.TrimPrefix(host, "unix://"))
+	}
+	candidates = append(candidates, "/var/run/docker.sock")
+	if runtimeDir := os.Getenv("XDG_RUNTIME_DIR"); runtimeDir != "" {
+		candidates = append(candidates, filepath.Join(runtimeDir, "docker.sock"))
+	}
+	candidates = append(candidates, filepath.Join("/run/user", strconv.Itoa(os.Getuid()), "docker.sock"))
+	candidates = append(candidates, userSockets("")...)
+	if lib.Args.HostRoot != "" {
+		candidates = append(candidates, filepath.Join(lib.Args.HostRoot, "/var/run/docker.sock"))
+		candidates = append(candidates, userSockets(lib.Args.HostRoot)...)
+	}
+
+	endpoints := []Endpoint{}
+	seen := map[string]bool{}
+	for _, path := range candidates {
+		if !isSocket(path) {
+			continue
+		}
+		// /var/run is usually a link to /run, the same socket is collected once
+		resolved, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			resolved = path
+		}
+		if seen[resolved] {
+			continue
+		}
+		seen[resolved] = true
+
+		endpoint := Endpoint{Host: "unix://" + path}
+		if len(endpoints) > 0 {
+			endpoint.Name = socketName(path)
+		}
+		log.Debug("found docker socket %s", path)
+		endpoints = append(endpoints, endpoint)
+	}
+	return endpoints
+}
+
+// DiscoverContainerd returns the containerd socket of a host without dockerd, or
+// an empty string. It is only looked for once no docker socket was found, as
+// dockerd runs its containers on the same containerd.
+func DiscoverContainerd() string {
+	candidates := []string{"/run/containerd/containerd.sock"}
+	if lib.Args.HostRoot != "" {
+		candidates = append(candidates, filepath.Join(lib.Args.HostRoot, "/run/containerd/containerd.sock"))
+	}
+	for _, path := range candidates {
+		if isSocket(path) {
+			log.Debug("found containerd socket %s", path)
+			return path
+		}
+	}
+	return ""
+}
+
+// userSockets lists the rootless sockets of every user below root
+func userSockets(root string) []string {
+	paths, err := filepath.Glob(filepath.Join(root, "/run/user/*/docker.sock"))
+	if err != nil {
+		return nil
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// socketName is rootless-<uid> for per user sockets, otherwise the socket path
+func socketName(path string) string {
+	if match := rootlessSocket.FindStringSubmatch(path); match != nil {
+		return "rootless-" + match[1]
+	}
+	return path
+}
+
+func isSocket(path string) bool {
+	fi, err := os.Stat(path)
+	return err == nil && fi.Mode()&os.ModeSocket != 0
+}
@@ -0,0 +1,102 @@
+package nrdocker
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/newrelic-experimental/nri-docker/internal/lib"
+)
+
+// listen creates a unix socket at path, closed when the test ends
+func listen(t *testing.T, path string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+}
+
+func TestDiscoverSockets(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no unix sockets")
+	}
+	if isSocket("/var/run/docker.sock") || len(userSockets("")) > 0 {
+		t.Skip("this machine has docker sockets of its own")
+	}
+	defer func(root string) { lib.Args.HostRoot = root }(lib.Args.HostRoot)
+	dir := t.TempDir()
+	host := filepath.Join(dir, "host")
+	lib.Args.HostRoot = host
+	listen(t, filepath.Join(dir, "custom/docker.sock"))
+	listen(t, filepath.Join(host, "var/run/docker.sock"))
+	listen(t, filepath.Join(host, "run/user/1001/docker.sock"))
+	listen(t, filepath.Join(host, "run/user/1000/docker.sock"))
+	// not a socket
+	os.MkdirAll(filepath.Join(host, "run/user/1002"), 0755)
+	ioutil.WriteFile(filepath.Join(host, "run/user/1002/docker.sock"), nil, 0644)
+	// the same socket as rootless-1000 through a link
+	os.MkdirAll(filepath.Join(dir, "xdg"), 0755)
+	if err := os.Symlink(filepath.Join(host, "run/user/1000/docker.sock"), filepath.Join(dir, "xdg/docker.sock")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		dockerHost string
+		want       []Endpoint
+	}{
+		{
+			name: "no DOCKER_HOST",
+			want: []Endpoint{
+				{Host: "unix://" + dir + "/xdg/docker.sock"},
+				{Name: host + "/var/run/docker.sock", Host: "unix://" + host + "/var/run/docker.sock"},
+				{Name: "rootless-1001", Host: "unix://" + host + "/run/user/1001/docker.sock"},
+			},
+		},
+		{
+			name:       "a unix DOCKER_HOST comes first",
+			dockerHost: "unix://" + dir + "/custom/docker.sock",
+			want: []Endpoint{
+				{Host: "unix://" + dir + "/custom/docker.sock"},
+				{Name: dir + "/xdg/docker.sock", Host: "unix://" + dir + "/xdg/docker.sock"},
+				{Name: host + "/var/run/docker.sock", Host: "unix://" + host + "/var/run/docker.sock"},
+				{Name: "rootless-1001", Host: "unix://" + host + "/run/user/1001/docker.sock"},
+			},
+		},
+		{
+			name:       "a DOCKER_HOST linking to another socket is collected once",
+			dockerHost: "unix://" + dir + "/xdg/docker.sock",
+			want: []Endpoint{
+				{Host: "unix://" + dir + "/xdg/docker.sock"},
+				{Name: host + "/var/run/docker.sock", Host: "unix://" + host + "/var/run/docker.sock"},
+				{Name: "rootless-1001", Host: "unix://" + host + "/run/user/1001/docker.sock"},
+			},
+		},
+		{
+			name:       "a tcp DOCKER_HOST is the only engine",
+			dockerHost: "tcp://10.0.0.5:2376",
+			want:       []Endpoint{{Host: "tcp://10.0.0.5:2376"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Setenv("DOCKER_HOST", tt.dockerHost)
+		t.Setenv("XDG_RUNTIME_DIR", filepath.Join(dir, "xdg"))
+		got := DiscoverSockets()
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: %+v, want %+v", tt.name, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i].Host != tt.want[i].Host || got[i].Name != tt.want[i].Name {
+				t.Errorf("%s: endpoint %d %+v, want %+v", tt.name, i, got[i], tt.want[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package nrdocker
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/docker/client"
+	"github.com/docker/go-connections/tlsconfig"
+	"github.com/newrelic-experimental/nri-docker/internal/lib"
+)
+
+// Endpoint is one Docker engine to collect from
+type Endpoint struct {
+	// Name identifies the engine, it is reported as the dockerHost attribute
+	Name string `json:"name"`
+	// Host is the daemon URL eg. unix:///var/run/docker.sock or tcp://10.0.0.5:2376, empty uses the default socket
+	Host      string `json:"host"`
+	TLSCACert string `json:"tlsCACert"`
+	TLSCert   string `json:"tlsCert"`
+	TLSKey    string `json:"tlsKey"`
+	// TLSVerify defaults to true whenever TLS files are given
+	TLSVerify *bool `json:"tlsVerify"`
+	// Containerd marks a containerd socket, collected without dockerd
+	Containerd bool `json:"containerd"`
+}
+
+// Endpoints returns the engines to collect from: the default one unless named
+// endpoints or docker contexts are configured, plus those named ones. With
+// nothing configured the sockets found on the host are used.
+func Endpoints() ([]Endpoint, error) {
+	named := []Endpoint{}
+	if strings.TrimSpace(lib.Args.Endpoints) != "" {
+		if err := json.Unmarshal([]byte(lib.Args.Endpoints), &named); err != nil {
+			return nil, fmt.Errorf("cannot parse endpoints: %v", err)
+		}
+		for _, e := range named {
+			if e.Name == "" {
+				return nil, fmt.Errorf("every endpoint needs a name")
+			}
+		}
+	}
+	if lib.Args.DockerContexts != "" {
+		contexts, err := LoadDockerContexts(lib.Args.DockerContexts)
+		if err != nil {
+			return nil, err
+		}
+		named = append(named, contexts...)
+	}
+
+	if lib.Args.ContainerdSocket != "" {
+		containerd := Endpoint{Host: "unix://" + lib.Args.ContainerdSocket, Containerd: true}
+		if len(named) > 0 || lib.Args.DockerHost != "" {
+			containerd.Name = "containerd"
+		}
+		named = append(named, containerd)
+	}
+
+	if len(named) > 0 && lib.Args.DockerHost == "" {
+		// a lone containerd socket is the default engine
+		if len(named) == 1 && named[0].Containerd {
+			named[0].Name = ""
+		}
+		return named, nil
+	}
+	if len(named) == 0 && lib.Args.DockerHost == "" && lib.Args.DiscoverSockets {
+		if discovered := DiscoverSockets(); len(discovered) > 0 {
+			return discovered, nil
+		}
+		if containerd := DiscoverContainerd(); containerd != "" {
+			return []Endpoint{{Host: "unix://" + containerd, Containerd: true}}, nil
+		}
+	}
+	verify := lib.Args.TLSVerify
+	local := Endpoint{
+		Host:      lib.Args.DockerHost,
+		TLSCACert: lib.Args.TLSCACert,
+		TLSCert:   lib.Args.TLSCert,
+		TLSKey:    lib.Args.TLSKey,
+		TLSVerify: &verify,
+	}
+	return append([]Endpoint{local}, named...), nil
+}
+
+// NewClient creates a client for the endpoint, apiVersion forces the API version when not empty
+func (e Endpoint) NewClient(apiVersion string) (*client.Client, error) {
+	opts := []client.Opt{}
+	if e.TLSCACert != "" || e.TLSCert != "" || e.TLSKey != "" {
+		verify := e.TLSVerify == nil || *e.TLSVerify
+		tlsConfig, err := tlsconfig.Client(tlsconfig.Options{
+			CAFile:             e.TLSCACert,
+			CertFile:           e.TLSCert,
+			KeyFile:            e.TLSKey,
+			InsecureSkipVerify: !verify,
+			ExclusiveRootPools: true,
+		})
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, client.WithHTTPClient(&http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}))
+	}
+	if e.Host != "" {
+		opts = append(opts, client.WithHost(e.Host))
+	}
+	if apiVersion != "" {
+		opts = append(opts, client.WithVersion(apiVersion))
+	} else {
+		opts = append(opts, client.WithAPIVersionNegotiation())
+	}
+	cli, err := client.NewClientWithOpts(opts...)
+	if err != nil {
+		return nil, err
+	}
+	// wrapped only once the client is built, the options expect the plain *http.Transport
+	httpClient := cli.HTTPClient()
+	httpClient.Transport = &lib.InstrumentedTransport{Base: httpClient.Transport}
+	return cli, nil
+}
+
+// dockerContextMeta is the part of ~/.docker/contexts/meta/<digest>/meta.json used here
+type dockerContextMeta struct {
+	Name      string
+	Endpoints map[string]struct {
+		Host          string
+		SkipTLSVerify bool
+	}
+}
+
+// LoadDockerContexts reads the named docker CLI contexts, a comma separated list or "all"
+func LoadDockerContexts(names string) ([]Endpoint, error) {
+	configDir := os.Getenv("DOCKER_CONFIG")
+	if configDir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		configDir = filepath.Join(home, ".docker")
+	}
+	metaDir := filepath.Join(configDir, "contexts", "meta")
+
+	wanted := map[string]bool{}
+	for _, name := range strings.Split(names, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			wanted[name] = true
+		}
+	}
+
+	dirs, err := ioutil.ReadDir(metaDir)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read docker contexts: %v", err)
+	}
+
+	endpoints := []Endpoint{}
+	for _, dir := range dirs {
+		raw, err := ioutil.ReadFile(filepath.Join(metaDir, dir.Name(), "meta.json"))
+		if err != nil {
+			continue
+		}
+		var meta dockerContextMeta
+		if err := json.Unmarshal(raw, &meta); err != nil {
+			return nil, fmt.Errorf("cannot parse docker context %s: %v", dir.Name(), err)
+		}
+		docker, ok := meta.Endpoints["docker"]
+		if !ok || (!wanted["all"] && !wanted[meta.Name]) {
+			continue
+		}
+		delete(wanted, meta.Name)
+
+		verify := !docker.SkipTLSVerify
+		endpoint := Endpoint{Name: meta.Name, Host: docker.Host, TLSVerify: &verify}
+		// TLS material lives next to the metadata under the same name digest
+		digest := sha256.Sum256([]byte(meta.Name))
+		tlsDir := filepath.Join(configDir, "contexts", "tls", hex.EncodeToString(digest[:]), "docker")
+		if fileExists(filepath.Join(tlsDir, "ca.pem")) {
+			endpoint.TLSCACert = filepath.Join(tlsDir, "ca.pem")
+		}
+		if fileExists(filepath.Join(tlsDir, "cert.pem")) && fileExists(filepath.Join(tlsDir, "key.pem")) {
+			endpoint.TLSCert = filepath.Join(tlsDir, "cert.pem")
+			endpoint.TLSKey = filepath.Join(tlsDir, "key.pem")
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+
+	delete(wanted, "all")
+	for name := range wanted {
+		return nil, fmt.Errorf("docker context %s not found", name)
+	}
+	return endpoints, nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
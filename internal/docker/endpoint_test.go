@@ -0,0 +1,208 @@
+package nrdocker
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCA issues certificates for the stand-in daemon and its clients
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns a PEM certificate and key, for the loopback address when server is set
+func (ca *testCA) issue(t *testing.T, server bool) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	if server {
+		template.Subject.CommonName = "127.0.0.1"
+		template.IPAddresses = []net.IP{net.ParseIP("127.0.0.1")}
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+}
+
+func writeFile(t *testing.T, path string, content []byte) string {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, content, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// tlsDaemon stands in for a dockerd listening on tcp with --tlsverify, it answers /_ping and /version
+func tlsDaemon(t *testing.T, ca *testCA, requireClientCert bool) *httptest.Server {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("API-Version", "1.40")
+		if strings.HasSuffix(r.URL.Path, "/version") {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"Version":"19.03.12","ApiVersion":"1.40"}`))
+		}
+	}))
+	certPEM, keyPEM := ca.issue(t, true)
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{cert}, ClientCAs: pool}
+	if requireClientCert {
+		server.TLS.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestEndpointTLS(t *testing.T) {
+	ca, other := newTestCA(t), newTestCA(t)
+	dir := t.TempDir()
+	caFile := writeFile(t, filepath.Join(dir, "ca.pem"), ca.pem)
+	otherCAFile := writeFile(t, filepath.Join(dir, "other-ca.pem"), other.pem)
+	certPEM, keyPEM := ca.issue(t, false)
+	certFile := writeFile(t, filepath.Join(dir, "cert.pem"), certPEM)
+	keyFile := writeFile(t, filepath.Join(dir, "key.pem"), keyPEM)
+	verify, skip := true, false
+
+	tests := []struct {
+		name       string
+		clientCert bool
+		endpoint   Endpoint
+		ok         bool
+	}{
+		{"ca and client certificate", true, Endpoint{TLSCACert: caFile, TLSCert: certFile, TLSKey: keyFile}, true},
+		{"verify defaults to true", true, Endpoint{TLSCACert: otherCAFile, TLSCert: certFile, TLSKey: keyFile}, false},
+		{"daemon signed by another ca", true, Endpoint{TLSCACert: otherCAFile, TLSCert: certFile, TLSKey: keyFile, TLSVerify: &verify}, false},
+		{"no client certificate", true, Endpoint{TLSCACert: caFile}, false},
+		{"ca only", false, Endpoint{TLSCACert: caFile}, true},
+		{"tls_verify=false", true, Endpoint{TLSCACert: otherCAFile, TLSCert: certFile, TLSKey: keyFile, TLSVerify: &skip}, true},
+		{"tls_verify=false without ca", true, Endpoint{TLSCert: certFile, TLSKey: keyFile, TLSVerify: &skip}, true},
+	}
+	for _, tt := range tests {
+		server := tlsDaemon(t, ca, tt.clientCert)
+		tt.endpoint.Host = "tcp://" + server.Listener.Addr().String()
+		cli, err := tt.endpoint.NewClient("")
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		version, err := cli.ServerVersion(ctx)
+		cancel()
+		if tt.ok && (err != nil || version.Version != "19.03.12") {
+			t.Errorf("%s: version %q, %v", tt.name, version.Version, err)
+		}
+		if !tt.ok && err == nil {
+			t.Errorf("%s: connected", tt.name)
+		}
+	}
+
+	if _, err := (Endpoint{Host: "tcp://127.0.0.1:2376", TLSCACert: filepath.Join(dir, "missing.pem")}).NewClient(""); err == nil {
+		t.Error("a missing ca file is not an error")
+	}
+}
+
+func TestLoadDockerContexts(t *testing.T) {
+	ca := newTestCA(t)
+	server := tlsDaemon(t, ca, true)
+	configDir := t.TempDir()
+	os.Setenv("DOCKER_CONFIG", configDir)
+	defer os.Unsetenv("DOCKER_CONFIG")
+
+	contexts := map[string]string{
+		"remote": `{"Name":"remote","Endpoints":{"docker":{"Host":"tcp://` + server.Listener.Addr().String() + `","SkipTLSVerify":false}}}`,
+		"kube":   `{"Name":"kube","Endpoints":{"kubernetes":{"Host":"https://10.0.0.1"}}}`,
+	}
+	for name, meta := range contexts {
+		digest := sha256.Sum256([]byte(name))
+		writeFile(t, filepath.Join(configDir, "contexts", "meta", hex.EncodeToString(digest[:]), "meta.json"), []byte(meta))
+	}
+	digest := sha256.Sum256([]byte("remote"))
+	tlsDir := filepath.Join(configDir, "contexts", "tls", hex.EncodeToString(digest[:]), "docker")
+	certPEM, keyPEM := ca.issue(t, false)
+	writeFile(t, filepath.Join(tlsDir, "ca.pem"), ca.pem)
+	writeFile(t, filepath.Join(tlsDir, "cert.pem"), certPEM)
+	writeFile(t, filepath.Join(tlsDir, "key.pem"), keyPEM)
+
+	endpoints, err := LoadDockerContexts("all")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(endpoints) != 1 || endpoints[0].Name != "remote" || endpoints[0].TLSCACert != filepath.Join(tlsDir, "ca.pem") || !*endpoints[0].TLSVerify {
+		t.Fatalf("endpoints %+v", endpoints)
+	}
+	cli, err := endpoints[0].NewClient("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cli.ServerVersion(context.Background()); err != nil {
+		t.Errorf("cannot reach the context's daemon: %v", err)
+	}
+
+	if _, err := LoadDockerContexts("missing"); err == nil {
+		t.Error("a missing context is not an error")
+	}
+}
@@ -0,0 +1,66 @@
+package nrdocker
+
+import (
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/newrelic-experimental/nri-docker/internal/lib"
+)
+
+// fsUsage is what statfs reports for a filesystem, in bytes
+type fsUsage struct {
+	Total      uint64
+	Free       uint64
+	Available  uint64
+	Inodes     uint64
+	InodesFree uint64
+}
+
+// setFilesystemMetrics reports dockerFilesystemSample for the filesystem backing
+// the daemon's root dir, with its growth rate and when it will be full at that rate
+func setFilesystemMetrics(cli *client.Client, entity *lib.Entity, info types.Info) {
+	if info.DockerRootDir == "" || !isLocalDaemon(cli) {
+		return
+	}
+	path := hostPath(info.DockerRootDir)
+	usage, err := statFS(path)
+	if err != nil {
+		lib.ReportError(entity, lib.WrapError(nil, "filesystem", "statfs", "", err))
+		return
+	}
+
+	metricSet := lib.NewSample("dockerFilesystemSample", entity)
+	lib.SetMetric(metricSet, "hostname", lib.Hostname)
+	lib.SetMetric(metricSet, "dockerRootDir", info.DockerRootDir)
+	lib.SetMetric(metricSet, "storageDriver", info.Driver)
+
+	used := usage.Total - usage.Free
+	lib.SetMetric(metricSet, "totalBytes", usage.Total)
+	lib.SetMetric(metricSet, "freeBytes", usage.Free)
+	lib.SetMetric(metricSet, "availableBytes", usage.Available)
+	lib.SetMetric(metricSet, "usedBytes", used)
+	// like df, space reserved for root counts as neither used nor available
+	if used+usage.Available > 0 {
+		lib.SetMetric(metricSet, "usedPercent", float64(used)/float64(used+usage.Available)*100)
+	}
+	inodesUsed := usage.Inodes - usage.InodesFree
+	lib.SetMetric(metricSet, "inodesTotal", usage.Inodes)
+	lib.SetMetric(metricSet, "inodesFree", usage.InodesFree)
+	lib.SetMetric(metricSet, "inodesUsed", inodesUsed)
+	if usage.Inodes > 0 {
+		lib.SetMetric(metricSet, "inodesUsedPercent", float64(inodesUsed)/float64(usage.Inodes)*100)
+	}
+
+	key := "filesystem/" + info.ID
+	if growth, ok := lib.GrowthRate(key+"/bytes", float64(used)); ok {
+		lib.SetMetric(metricSet, "growthBytesPerSecond", growth)
+		if growth > 0 {
+			lib.SetMetric(metricSet, "timeToFullSeconds", float64(usage.Available)/growth)
+		}
+	}
+	if growth, ok := lib.GrowthRate(key+"/inodes", float64(inodesUsed)); ok {
+		lib.SetMetric(metricSet, "inodesGrowthPerSecond", growth)
+		if growth > 0 {
+			lib.SetMetric(metricSet, "inodesTimeToFullSeconds", float64(usage.InodesFree)/growth)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package nrdocker
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/newrelic-experimental/nri-docker/internal/lib"
+)
+
+func TestSetFilesystemMetrics(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("statfs is read on linux only")
+	}
+	defer func(files bool) { lib.Args.HostFiles = files }(lib.Args.HostFiles)
+	lib.Args.HostFiles = true
+	local, _ := client.NewClientWithOpts(client.WithHost("unix:///var/run/docker.sock"))
+	remote, _ := client.NewClientWithOpts(client.WithHost("tcp://10.0.0.5:2376"))
+	root := t.TempDir()
+
+	tests := []struct {
+		name    string
+		cli     *client.Client
+		info    types.Info
+		samples int
+		errors  int
+	}{
+		{"a local daemon", local, types.Info{ID: "fs-test", DockerRootDir: root, Driver: "overlay2"}, 1, 0},
+		{"a remote daemon", remote, types.Info{ID: "fs-test", DockerRootDir: root}, 0, 0},
+		{"no root dir", local, types.Info{ID: "fs-test"}, 0, 0},
+		{"a missing root dir", local, types.Info{ID: "fs-test", DockerRootDir: root + "/missing"}, 0, 1},
+	}
+	for _, tt := range tests {
+		entity := lib.NewPayload().LocalEntity()
+		setFilesystemMetrics(tt.cli, entity, tt.info)
+		samples, errors := 0, 0
+		for _, sample := range entity.Samples {
+			switch sample.Event {
+			case "dockerFilesystemSample":
+				samples++
+				m := sample.Metrics
+				total, _ := m["totalBytes"].(float64)
+				used, _ := m["usedPercent"].(float64)
+				if total <= 0 || used < 0 || used > 100 || m["dockerRootDir"] != root || m["storageDriver"] != "overlay2" {
+					t.Errorf("%s: %v", tt.name, m)
+				}
+				if _, ok := m["growthBytesPerSecond"]; ok {
+					t.Errorf("%s: a growth rate from a single reading", tt.name)
+				}
+			case "dockerIntegrationError":
+				errors++
+			}
+		}
+		if samples != tt.samples || errors != tt.errors {
+			t.Errorf("%s: %d samples and %d errors, want %d and %d", tt.name, samples, errors, tt.samples, tt.errors)
+		}
+	}
+}
@@ -2,19 +2,73 @@ package nrdocker
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"strings"
+	"time"
 
+	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/client"
 	"github.com/newrelic-experimental/nri-docker/internal/lib"
-	"github.com/newrelic/infra-integrations-sdk/integration"
 )
 
+// isRootless recognises a rootless daemon from its security options eg. name=rootless
+func isRootless(securityOptions []string) bool {
+	for _, option := range securityOptions {
+		for _, field := range strings.Split(option, ",") {
+			if field == "name=rootless" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// daemonInfo is /info together with what the pinned client types do not decode
+type daemonInfo struct {
+	types.Info
+	// reported by newer daemons eg. 2
+	CgroupVersion string
+}
+
+// getDaemonInfo reads /info once for every collector that needs it. The request is made at
+// the client's API version, negotiated by an earlier call of the docker client.
+func getDaemonInfo(ctx context.Context, cli *client.Client) (daemonInfo, error) {
+	info := daemonInfo{}
+	err := engineGet(ctx, cli, "/v"+cli.ClientVersion()+"/info", &info)
+	return info, err
+}
+
+// addWarningEvents publishes the daemon warnings that are new or were not reported by the
+// previous run as events, warnings that persist are only counted
+func addWarningEvents(cli *client.Client, entity *lib.Entity, warnings []string) {
+	now := time.Now().UnixNano()
+	key := "warnings/" + cli.DaemonHost()
+	previousRun, ok := lib.Checkpoint(key, now)
+	for _, warning := range warnings {
+		digest := sha256.Sum256([]byte(warning))
+		lastSeen, seen := lib.Checkpoint(key+"/"+hex.EncodeToString(digest[:8]), now)
+		if !ok || !seen || lastSeen < previousRun {
+			entity.AddEvent(warning, "docker")
+		}
+	}
+}
+
 // GetHostInfo x
-func GetHostInfo(cli *client.Client, entity *integration.Entity) {
-	ctx := context.Background()
-	info, err := cli.Info(ctx)
+func GetHostInfo(ctx context.Context, cli *client.Client, entity *lib.Entity) {
+	// also negotiates the API version used for /info
+	callCtx, cancel := lib.CallContext(ctx)
+	serverVersion, versionErr := cli.ServerVersion(callCtx)
+	versionErr = lib.WrapError(callCtx, "hostInfo", "/version", "", versionErr)
+	cancel()
+
+	callCtx, cancel = lib.CallContext(ctx)
+	info, err := getDaemonInfo(callCtx, cli)
+	err = lib.WrapError(callCtx, "hostInfo", "/info", "", err)
+	cancel()
 	if err == nil {
-		metricSet := lib.NewMetricSet("dockerInfoSample", entity)
+		metricSet := lib.NewSample("dockerInfoSample", entity)
 		lib.SetMetric(metricSet, "containers", info.Containers)
 		lib.SetMetric(metricSet, "containersRunning", info.ContainersRunning)
 		lib.SetMetric(metricSet, "containersPaused", info.ContainersPaused)
@@ -35,22 +89,36 @@ func GetHostInfo(cli *client.Client, entity *integration.Entity) {
 		lib.SetMetric(metricSet, "swapLimit", info.SwapLimit)
 		lib.SetMetric(metricSet, "memTotal", info.MemTotal)
 		lib.SetMetric(metricSet, "memLimit", info.MemoryLimit)
+		lib.SetMetric(metricSet, "daemonHost", cli.DaemonHost())
+		lib.SetMetric(metricSet, "rootless", isRootless(info.SecurityOptions))
 
 		for _, label := range info.Labels {
 			lib.ApplyLabel(label, metricSet, "")
 		}
+		setDaemonInventory(entity, info.Info)
+		setStorageDriverMetrics(entity, info.Info)
+		setFilesystemMetrics(cli, entity, info.Info)
+		lib.SetMetric(metricSet, "warnings", len(info.Warnings))
+		addWarningEvents(cli, entity, info.Warnings)
+		checkDaemonCompliance(ctx, cli, entity, info)
 
-		serverVersion, err := cli.ServerVersion(ctx)
-		if err == nil {
+		if versionErr != nil {
+			lib.ReportError(entity, versionErr)
+		} else {
 			lib.SetMetric(metricSet, "serverVersion", serverVersion.Version)
 			lib.SetMetric(metricSet, "serverGoVersion", serverVersion.GoVersion)
 			lib.SetMetric(metricSet, "serverApiVersion", serverVersion.APIVersion)
 			lib.SetMetric(metricSet, "serverGitCommit", serverVersion.GitCommit)
 			lib.SetMetric(metricSet, "serverBuildTime", serverVersion.BuildTime)
+			runtime, runtimeVersion := runtimeOf(serverVersion)
+			lib.Runtime = runtime
+			lib.SetMetric(metricSet, "runtime", runtime)
+			lib.SetMetric(metricSet, "runtimeVersion", runtimeVersion)
 		}
 
 		lib.SetMetric(metricSet, "swarmState", fmt.Sprintf("%v", info.Swarm.LocalNodeState))
 		lib.SwarmState = fmt.Sprintf("%v", info.Swarm.LocalNodeState)
+		lib.CgroupDriver = info.CgroupDriver
 		lib.SetMetric(metricSet, "swarmControlAvailable", fmt.Sprintf("%v", info.Swarm.ControlAvailable))
 		lib.SetMetric(metricSet, "swarmError", info.Swarm.Error)
 		lib.SetMetric(metricSet, "swarmNodeID", info.Swarm.NodeID)
@@ -67,6 +135,6 @@ func GetHostInfo(cli *client.Client, entity *integration.Entity) {
 		}
 
 	} else {
-		lib.ErrorLogToInsights(err, entity)
+		lib.ReportError(entity, err)
 	}
 }
@@ -0,0 +1,120 @@
+package nrdocker
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sync"
+	"testing"
+
+	"github.com/newrelic-experimental/nri-docker/internal/lib"
+)
+
+// fakeDaemon answers the calls GetHostInfo makes and counts them by versionless path
+type fakeDaemon struct {
+	lock     sync.Mutex
+	calls    map[string]int
+	warnings []string
+}
+
+var versionPrefix = regexp.MustCompile(`^/v[0-9.]+`)
+
+func (d *fakeDaemon) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := versionPrefix.ReplaceAllString(r.URL.Path, "")
+	d.lock.Lock()
+	d.calls[path]++
+	warnings := d.warnings
+	d.lock.Unlock()
+
+	w.Header().Set("API-Version", "1.41")
+	w.Header().Set("Content-Type", "application/json")
+	switch path {
+	case "/_ping":
+	case "/version":
+		json.NewEncoder(w).Encode(map[string]string{"Version": "20.10.17", "ApiVersion": "1.41"})
+	case "/info":
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"ID":              "7TRN:IPZB",
+			"Driver":          "overlay2",
+			"CgroupDriver":    "systemd",
+			"CgroupVersion":   "2",
+			"LoggingDriver":   "json-file",
+			"SecurityOptions": []string{"name=seccomp,profile=default", "name=cgroupns"},
+			"Warnings":        warnings,
+		})
+	case "/networks/bridge":
+		json.NewEncoder(w).Encode(map[string]interface{}{"Name": "bridge", "Options": map[string]string{"com.docker.network.bridge.enable_icc": "false"}})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestGetHostInfo(t *testing.T) {
+	defer func(checks bool) { lib.Args.SecurityChecks = checks }(lib.Args.SecurityChecks)
+	lib.Args.SecurityChecks = true
+	daemon := &fakeDaemon{calls: map[string]int{}, warnings: []string{"WARNING: No swap limit support", "WARNING: bridge-nf-call-iptables is disabled"}}
+	server := httptest.NewServer(daemon)
+	defer server.Close()
+	cli, err := Endpoint{Host: "tcp://" + server.Listener.Addr().String()}.NewClient("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runs := []struct {
+		warnings []string
+		events   []string
+	}{
+		{daemon.warnings, daemon.warnings},
+		// persisting warnings are not repeated
+		{daemon.warnings, nil},
+		{[]string{"WARNING: No swap limit support", "WARNING: API is accessible on http://0.0.0.0:2375 without encryption."}, []string{"WARNING: API is accessible on http://0.0.0.0:2375 without encryption."}},
+		{nil, nil},
+		// gone for a run and back
+		{[]string{"WARNING: No swap limit support"}, []string{"WARNING: No swap limit support"}},
+	}
+	for i, run := range runs {
+		daemon.lock.Lock()
+		daemon.warnings = run.warnings
+		daemon.lock.Unlock()
+		entity := lib.NewPayload().LocalEntity()
+		GetHostInfo(context.Background(), cli, entity)
+
+		events := []string{}
+		for _, event := range entity.Events {
+			events = append(events, event.Summary)
+		}
+		if len(events) != len(run.events) {
+			t.Errorf("run %d: events %q, want %q", i, events, run.events)
+			continue
+		}
+		for j := range events {
+			if events[j] != run.events[j] {
+				t.Errorf("run %d: events %q, want %q", i, events, run.events)
+			}
+		}
+
+		for _, sample := range entity.Samples {
+			switch sample.Event {
+			case "dockerInfoSample":
+				if sample.Metrics["warnings"] != float64(len(run.warnings)) || sample.Metrics["serverVersion"] != "20.10.17" {
+					t.Errorf("run %d: dockerInfoSample %v", i, sample.Metrics)
+				}
+			case "dockerDaemonComplianceSample":
+				if sample.Metrics["cgroupVersion"] != "2" || sample.Metrics["check.icc"] != "pass" {
+					t.Errorf("run %d: cgroupVersion %v and check.icc %v", i, sample.Metrics["cgroupVersion"], sample.Metrics["check.icc"])
+				}
+			case "dockerIntegrationError":
+				t.Errorf("run %d: %v", i, sample.Metrics["errorMsg"])
+			}
+		}
+	}
+
+	if daemon.calls["/info"] != len(runs) {
+		t.Errorf("/info requested %d times in %d runs", daemon.calls["/info"], len(runs))
+	}
+	if daemon.calls["/networks/bridge"] != 1 {
+		t.Errorf("the bridge network inspected %d times", daemon.calls["/networks/bridge"])
+	}
+}
@@ -0,0 +1,149 @@
+package nrdocker
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/newrelic-experimental/nri-docker/internal/lib"
+)
+
+// setContainerInventory publishes the effective config of a container as
+// inventory, so changes to it show up in inventory change tracking
+func setContainerInventory(entity *lib.Entity, inspect types.ContainerJSON) {
+	if !lib.Args.ContainerInventory || !lib.Args.HasInventory() {
+		return
+	}
+	if inspect.ContainerJSONBase != nil {
+		entity.SetInventoryItem("container/name", "value", strings.TrimPrefix(inspect.Name, "/"))
+		entity.SetInventoryItem("container/imageId", "value", inspect.Image)
+		entity.SetInventoryItem("container/driver", "value", inspect.Driver)
+	}
+
+	if config := inspect.Config; config != nil {
+		entity.SetInventoryItem("container/image", "value", config.Image)
+		entity.SetInventoryItem("container/command", "value", strings.Join(config.Cmd, " "))
+		entity.SetInventoryItem("container/entrypoint", "value", strings.Join(config.Entrypoint, " "))
+		entity.SetInventoryItem("container/user", "value", config.User)
+		entity.SetInventoryItem("container/workingDir", "value", config.WorkingDir)
+		for _, env := range config.Env {
+			key := strings.SplitN(env, "=", 2)[0]
+			// only which variables are set is tracked
+			entity.SetInventoryItem("env/"+key, "value", lib.RedactedValue)
+		}
+	}
+
+	if hostConfig := inspect.HostConfig; hostConfig != nil {
+		entity.SetInventoryItem("restartPolicy/name", "value", hostConfig.RestartPolicy.Name)
+		entity.SetInventoryItem("restartPolicy/maximumRetryCount", "value", hostConfig.RestartPolicy.MaximumRetryCount)
+
+		entity.SetInventoryItem("limits/memory", "value", hostConfig.Memory)
+		entity.SetInventoryItem("limits/memorySwap", "value", hostConfig.MemorySwap)
+		entity.SetInventoryItem("limits/memoryReservation", "value", hostConfig.MemoryReservation)
+		entity.SetInventoryItem("limits/nanoCpus", "value", hostConfig.NanoCPUs)
+		entity.SetInventoryItem("limits/cpuShares", "value", hostConfig.CPUShares)
+		entity.SetInventoryItem("limits/cpuQuota", "value", hostConfig.CPUQuota)
+		entity.SetInventoryItem("limits/cpuPeriod", "value", hostConfig.CPUPeriod)
+		entity.SetInventoryItem("limits/cpusetCpus", "value", hostConfig.CpusetCpus)
+		entity.SetInventoryItem("limits/blkioWeight", "value", hostConfig.BlkioWeight)
+		if hostConfig.PidsLimit != nil {
+			entity.SetInventoryItem("limits/pidsLimit", "value", *hostConfig.PidsLimit)
+		}
+
+		entity.SetInventoryItem("security/privileged", "value", hostConfig.Privileged)
+		entity.SetInventoryItem("security/readonlyRootfs", "value", hostConfig.ReadonlyRootfs)
+		entity.SetInventoryItem("security/capAdd", "value", strings.Join(hostConfig.CapAdd, ","))
+		entity.SetInventoryItem("security/capDrop", "value", strings.Join(hostConfig.CapDrop, ","))
+		entity.SetInventoryItem("security/securityOpt", "value", strings.Join(hostConfig.SecurityOpt, ","))
+		entity.SetInventoryItem("security/usernsMode", "value", string(hostConfig.UsernsMode))
+		entity.SetInventoryItem("security/pidMode", "value", string(hostConfig.PidMode))
+		entity.SetInventoryItem("security/ipcMode", "value", string(hostConfig.IpcMode))
+
+		entity.SetInventoryItem("logging/driver", "value", hostConfig.LogConfig.Type)
+		for key, val := range hostConfig.LogConfig.Config {
+			// eg. splunk-token and awslogs-credentials
+			entity.SetInventoryItem("logging/"+key, "value", lib.RedactSetting(key, val))
+		}
+		entity.SetInventoryItem("network/mode", "value", string(hostConfig.NetworkMode))
+	}
+
+	for _, mount := range inspect.Mounts {
+		key := "mounts/" + mount.Destination
+		entity.SetInventoryItem(key, "type", string(mount.Type))
+		entity.SetInventoryItem(key, "source", mount.Source)
+		entity.SetInventoryItem(key, "name", mount.Name)
+		entity.SetInventoryItem(key, "mode", mount.Mode)
+		entity.SetInventoryItem(key, "rw", mount.RW)
+		entity.SetInventoryItem(key, "propagation", string(mount.Propagation))
+	}
+
+	if inspect.NetworkSettings != nil {
+		for name, network := range inspect.NetworkSettings.Networks {
+			if network == nil {
+				continue
+			}
+			key := "networks/" + name
+			entity.SetInventoryItem(key, "networkId", network.NetworkID)
+			entity.SetInventoryItem(key, "ipAddress", network.IPAddress)
+			entity.SetInventoryItem(key, "gateway", network.Gateway)
+			entity.SetInventoryItem(key, "macAddress", network.MacAddress)
+			entity.SetInventoryItem(key, "aliases", strings.Join(network.Aliases, ","))
+		}
+	}
+}
+
+// setDaemonInventory publishes the daemon settings reported by /info as inventory
+func setDaemonInventory(entity *lib.Entity, info types.Info) {
+	if !lib.Args.ContainerInventory || !lib.Args.HasInventory() {
+		return
+	}
+	settings := map[string]interface{}{
+		"serverVersion":      info.ServerVersion,
+		"storageDriver":      info.Driver,
+		"loggingDriver":      info.LoggingDriver,
+		"cgroupDriver":       info.CgroupDriver,
+		"kernelVersion":      info.KernelVersion,
+		"operatingSystem":    info.OperatingSystem,
+		"osType":             info.OSType,
+		"architecture":       info.Architecture,
+		"dockerRootDir":      info.DockerRootDir,
+		"defaultRuntime":     info.DefaultRuntime,
+		"liveRestoreEnabled": info.LiveRestoreEnabled,
+		"experimentalBuild":  info.ExperimentalBuild,
+		"isolation":          string(info.Isolation),
+		"initBinary":         info.InitBinary,
+		"httpProxy":          info.HTTPProxy,
+		"httpsProxy":         info.HTTPSProxy,
+		"noProxy":            info.NoProxy,
+		"securityOptions":    strings.Join(info.SecurityOptions, ","),
+		"labels":             strings.Join(info.Labels, ","),
+		"swarmState":         string(info.Swarm.LocalNodeState),
+		"ncpu":               info.NCPU,
+		"memTotal":           info.MemTotal,
+	}
+	for name, val := range settings {
+		entity.SetInventoryItem("daemon/"+name, "value", val)
+	}
+
+	runtimes := []string{}
+	for name := range info.Runtimes {
+		runtimes = append(runtimes, name)
+	}
+	sort.Strings(runtimes)
+	entity.SetInventoryItem("daemon/runtimes", "value", strings.Join(runtimes, ","))
+
+	if registry := info.RegistryConfig; registry != nil {
+		entity.SetInventoryItem("daemon/registryMirrors", "value", strings.Join(registry.Mirrors, ","))
+		insecure := []string{}
+		for _, cidr := range registry.InsecureRegistryCIDRs {
+			insecure = append(insecure, cidr.String())
+		}
+		for name, index := range registry.IndexConfigs {
+			if index != nil && !index.Secure {
+				insecure = append(insecure, name)
+			}
+		}
+		sort.Strings(insecure)
+		entity.SetInventoryItem("daemon/insecureRegistries", "value", strings.Join(insecure, ","))
+	}
+}
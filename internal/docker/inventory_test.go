@@ -0,0 +1,53 @@
+package nrdocker
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/newrelic-experimental/nri-docker/internal/lib"
+)
+
+func TestContainerInventoryRedaction(t *testing.T) {
+	defer func(inventory bool) { lib.Args.ContainerInventory = inventory }(lib.Args.ContainerInventory)
+	lib.Args.ContainerInventory = true
+
+	inspect := types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			Name: "/web",
+			HostConfig: &container.HostConfig{
+				LogConfig: container.LogConfig{
+					Type: "splunk",
+					Config: map[string]string{
+						"splunk-token":        "176FCEBF-4CF5-4EDF-91BC-703796522D20",
+						"splunk-url":          "https://splunk.example.com:8088",
+						"awslogs-credentials": "AKIAEXAMPLE:wJalrXUtnFEMI",
+						"fluentd-auth":        "shared-key",
+						"gelf-tcp-password":   "hunter2",
+						"tag":                 "{{.Name}}",
+					},
+				},
+			},
+		},
+		Config: &container.Config{Env: []string{"DB_HOST=db", "DB_PASSWORD=hunter2"}},
+	}
+	entity := lib.NewPayload().Entity("web", "docker")
+	setContainerInventory(entity, inspect)
+
+	expected := map[string]interface{}{
+		"logging/driver":              "splunk",
+		"logging/splunk-token":        lib.RedactedValue,
+		"logging/awslogs-credentials": lib.RedactedValue,
+		"logging/fluentd-auth":        lib.RedactedValue,
+		"logging/gelf-tcp-password":   lib.RedactedValue,
+		"logging/splunk-url":          "https://splunk.example.com:8088",
+		"logging/tag":                 "{{.Name}}",
+		"env/DB_HOST":                 lib.RedactedValue,
+		"env/DB_PASSWORD":             lib.RedactedValue,
+	}
+	for key, val := range expected {
+		if got := entity.Inventory[key]["value"]; got != val {
+			t.Errorf("%s is %v, want %v", key, got, val)
+		}
+	}
+}
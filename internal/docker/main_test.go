@@ -0,0 +1,17 @@
+package nrdocker
+
+import (
+	"os"
+	"testing"
+
+	"github.com/newrelic-experimental/nri-docker/internal/lib"
+)
+
+func TestMain(m *testing.M) {
+	// the argument defaults the collectors rely on, SetMetric drops everything with an empty exclude
+	lib.Args.Exclude = "true"
+	lib.Args.Interval = 15
+	lib.Args.GrowthWindow = 3600
+	lib.Args.LogLineLength = 256
+	os.Exit(m.Run())
+}
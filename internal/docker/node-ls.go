@@ -8,18 +8,18 @@ import (
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/client"
 	"github.com/newrelic-experimental/nri-docker/internal/lib"
-	"github.com/newrelic/infra-integrations-sdk/integration"
 	"vbom.ml/util/sortorder"
 	// "vbom.ml/util/sortorder"
 )
 
 // GetNodes x
-func GetNodes(cli *client.Client, entity *integration.Entity) {
-	ctx := context.Background()
+func GetNodes(ctx context.Context, cli *client.Client, entity *lib.Entity) {
+	callCtx, cancel := lib.CallContext(ctx)
+	defer cancel()
 
-	nodes, err := cli.NodeList(ctx, types.NodeListOptions{})
+	nodes, err := cli.NodeList(callCtx, types.NodeListOptions{})
 	if err != nil {
-		lib.ErrorLogToInsights(err, entity)
+		lib.ReportError(entity, lib.WrapError(callCtx, "nodes", "/nodes", "", err))
 	} else {
 
 		sort.Slice(nodes, func(i, j int) bool {
@@ -27,7 +27,7 @@ func GetNodes(cli *client.Client, entity *integration.Entity) {
 		})
 
 		for _, node := range nodes {
-			metricSet := lib.NewMetricSet("dockerNodeSample", entity)
+			metricSet := lib.NewSample("dockerNodeSample", entity)
 			lib.SetMetric(metricSet, "nodeID", node.ID)
 			lib.SetMetric(metricSet, "message", node.Status.Message)
 			lib.SetMetric(metricSet, "state", fmt.Sprintf("%v", node.Status.State))
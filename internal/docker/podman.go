@@ -0,0 +1,220 @@
+package nrdocker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/go-units"
+	"github.com/newrelic-experimental/nri-docker/internal/lib"
+)
+
+// runtimeOf tells a Podman socket apart from a Docker engine by the components it reports
+func runtimeOf(version types.Version) (string, string) {
+	for _, component := range version.Components {
+		if strings.Contains(strings.ToLower(component.Name), "podman") {
+			return "podman", component.Version
+		}
+	}
+	return "docker", version.Version
+}
+
+// podmanPod is the part of a libpod /libpod/pods/json entry used here
+type podmanPod struct {
+	ID         string `json:"Id"`
+	Name       string
+	Namespace  string
+	Status     string
+	Created    string
+	InfraID    string `json:"InfraId"`
+	Cgroup     string
+	Labels     map[string]string
+	Containers []struct {
+		ID     string `json:"Id"`
+		Names  string
+		Status string
+	}
+}
+
+// podmanPodStats is one member container of a /libpod/pods/stats entry, values are human readable
+type podmanPodStats struct {
+	Pod      string
+	CID      string
+	CPU      string
+	MemUsage string
+	NetIO    string
+	BlockIO  string
+	PIDS     string
+}
+
+// GetPods reports one podmanPodSample per Podman pod
+func GetPods(ctx context.Context, cli *client.Client, entity *lib.Entity, payload *lib.Payload) {
+	pods := []podmanPod{}
+	callCtx, cancel := lib.CallContext(ctx)
+	err := engineGet(callCtx, cli, "/libpod/pods/json", &pods)
+	err = lib.WrapError(callCtx, "pods", "/libpod/pods/json", "", err)
+	cancel()
+	if err != nil {
+		lib.ReportError(entity, err)
+		return
+	}
+
+	stats := []podmanPodStats{}
+	callCtx, cancel = lib.CallContext(ctx)
+	err = engineGet(callCtx, cli, "/libpod/pods/stats?all=true", &stats)
+	err = lib.WrapError(callCtx, "pods", "/libpod/pods/stats", "", err)
+	cancel()
+	if err != nil {
+		// membership is still worth reporting without usage
+		lib.ReportError(entity, err)
+	}
+
+	for _, pod := range pods {
+		podEntity := payload.Entity(pod.ID, "podman")
+		metricSet := lib.NewSample("podmanPodSample", podEntity)
+		lib.SetMetric(metricSet, "hostname", lib.Hostname)
+		lib.SetMetric(metricSet, "podId", pod.ID)
+		lib.SetMetric(metricSet, "podName", pod.Name)
+		lib.SetMetric(metricSet, "podNamespace", pod.Namespace)
+		lib.SetMetric(metricSet, "status", pod.Status)
+		lib.SetMetric(metricSet, "created", pod.Created)
+		lib.SetMetric(metricSet, "cgroup", pod.Cgroup)
+		lib.SetMetric(metricSet, "infraContainerId", pod.InfraID)
+
+		members, running := []string{}, 0
+		for _, container := range pod.Containers {
+			members = append(members, shortID(container.ID))
+			if strings.EqualFold(container.Status, "running") {
+				running++
+			}
+		}
+		lib.SetMetric(metricSet, "containers", len(pod.Containers))
+		lib.SetMetric(metricSet, "containersRunning", running)
+		lib.SetMetric(metricSet, "memberContainers", strings.Join(members, ","))
+
+		setPodUsage(metricSet, pod.ID, stats)
+
+		for key, val := range pod.Labels {
+			lib.SetMetric(metricSet, key, val)
+		}
+	}
+}
+
+// setPodUsage sums the usage of the pod's member containers, Podman reports them already formatted
+func setPodUsage(metricSet *lib.Sample, podID string, stats []podmanPodStats) {
+	var cpuPercent, memUsage, memLimit, netRx, netTx, blkRead, blkWrite, pids float64
+	found := false
+	for _, s := range stats {
+		// the stats endpoint shortens pod IDs
+		if s.Pod == "" || !strings.HasPrefix(podID, s.Pod) {
+			continue
+		}
+		found = true
+		cpuPercent += parsePercent(s.CPU)
+		usage, limit := parseSizePair(s.MemUsage)
+		memUsage += usage
+		// members share the pod limit, summing it would overstate it
+		if limit > memLimit {
+			memLimit = limit
+		}
+		rx, tx := parseSizePair(s.NetIO)
+		netRx += rx
+		netTx += tx
+		read, write := parseSizePair(s.BlockIO)
+		blkRead += read
+		blkWrite += write
+		if n, err := strconv.ParseFloat(strings.TrimSpace(s.PIDS), 64); err == nil {
+			pids += n
+		}
+	}
+	if !found {
+		return
+	}
+	lib.SetMetric(metricSet, "cpuPercent", cpuPercent)
+	lib.SetMetric(metricSet, "memPercent", calculateMemPercentUnixNoCache(memLimit, memUsage))
+	lib.SetMetric(metricSet, "memUsageBytes", memUsage)
+	lib.SetMetric(metricSet, "memLimitBytes", memLimit)
+	lib.SetMetric(metricSet, "netRxBytes", netRx)
+	lib.SetMetric(metricSet, "netTxBytes", netTx)
+	lib.SetMetric(metricSet, "blkReadBytes", blkRead)
+	lib.SetMetric(metricSet, "blkWriteBytes", blkWrite)
+	lib.SetMetric(metricSet, "pids", pids)
+}
+
+func parsePercent(val string) float64 {
+	f, _ := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(val), "%"), 64)
+	return f
+}
+
+// parseSizePair reads "1.2MB / 2GB" as two byte counts
+func parseSizePair(val string) (float64, float64) {
+	parts := strings.SplitN(val, "/", 2)
+	first := parseSize(parts[0])
+	if len(parts) < 2 {
+		return first, 0
+	}
+	return first, parseSize(parts[1])
+}
+
+func parseSize(val string) float64 {
+	size, err := units.FromHumanSize(strings.TrimSpace(val))
+	if err != nil {
+		return 0
+	}
+	return float64(size)
+}
+
+// engineGet decodes an endpoint without a docker client method, such as the libpod ones served on the same socket
+func engineGet(ctx context.Context, cli *client.Client, path string, out interface{}) error {
+	hostURL, err := client.ParseHostURL(cli.DaemonHost())
+	if err != nil {
+		return err
+	}
+	scheme, host := "http", hostURL.Host
+	if usesTLS(cli) {
+		scheme = "https"
+	}
+	if hostURL.Scheme == "unix" || hostURL.Scheme == "npipe" {
+		// the transport dials the socket, the host only has to be valid
+		host = "docker"
+	}
+
+	req, err := http.NewRequest("GET", scheme+"://"+host+path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := cli.HTTPClient().Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		err := fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+		switch {
+		case resp.StatusCode == http.StatusNotFound:
+			return errdefs.NotFound(err)
+		case resp.StatusCode >= 500:
+			return errdefs.System(err)
+		}
+		return err
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func usesTLS(cli *client.Client) bool {
+	transport := cli.HTTPClient().Transport
+	if instrumented, ok := transport.(*lib.InstrumentedTransport); ok {
+		transport = instrumented.Base
+	}
+	t, ok := transport.(*http.Transport)
+	return ok && t.TLSClientConfig != nil
+}
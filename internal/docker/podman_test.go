@@ -0,0 +1,49 @@
+package nrdocker
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types"
+)
+
+func TestParseSizePair(t *testing.T) {
+	tests := []struct {
+		val           string
+		first, second float64
+	}{
+		// podman pod stats reports sizes with decimal units
+		{"1.52MB / 33.34GB", 1.52e6, 33.34e9},
+		{"978B / 1.266kB", 978, 1266},
+		{"0B / 0B", 0, 0},
+		{"12.3MB", 12.3e6, 0},
+		{"-- / --", 0, 0},
+		{"", 0, 0},
+	}
+	for _, tt := range tests {
+		first, second := parseSizePair(tt.val)
+		if first != tt.first || second != tt.second {
+			t.Errorf("parseSizePair(%q) = %v, %v, want %v, %v", tt.val, first, second, tt.first, tt.second)
+		}
+	}
+}
+
+func TestRuntimeOf(t *testing.T) {
+	tests := []struct {
+		name    string
+		version types.Version
+		runtime string
+		want    string
+	}{
+		{"docker", types.Version{Version: "20.10.17", Components: []types.ComponentVersion{{Name: "Engine", Version: "20.10.17"}, {Name: "containerd", Version: "1.6.8"}}}, "docker", "20.10.17"},
+		{"podman", types.Version{Version: "4.3.1", Components: []types.ComponentVersion{{Name: "Podman Engine", Version: "4.3.1"}, {Name: "Conmon", Version: "2.1.4"}}}, "podman", "4.3.1"},
+		// the compat version can differ from the podman one
+		{"podman reporting a docker version", types.Version{Version: "20.10.0", Components: []types.ComponentVersion{{Name: "Podman Engine", Version: "3.4.4"}}}, "podman", "3.4.4"},
+		{"no components", types.Version{Version: "1.13.1"}, "docker", "1.13.1"},
+	}
+	for _, tt := range tests {
+		runtime, version := runtimeOf(tt.version)
+		if runtime != tt.runtime || version != tt.want {
+			t.Errorf("%s: %s %s, want %s %s", tt.name, runtime, version, tt.runtime, tt.want)
+		}
+	}
+}
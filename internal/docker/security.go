@@ -0,0 +1,194 @@
+package nrdocker
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/newrelic-experimental/nri-docker/internal/lib"
+)
+
+// capabilities that give a container control over the host
+var dangerousCapabilities = map[string]bool{
+	"ALL": true, "SYS_ADMIN": true, "SYS_MODULE": true, "SYS_PTRACE": true, "SYS_RAWIO": true,
+	"NET_ADMIN": true, "DAC_READ_SEARCH": true, "SYS_BOOT": true, "SYS_TIME": true, "MAC_ADMIN": true,
+}
+
+// host paths that must not be mounted into containers, nor anything below them
+var sensitiveHostPaths = []string{"/", "/boot", "/dev", "/etc", "/lib", "/proc", "/sys", "/usr", "/var/lib/docker"}
+
+// runtime sockets that hand the daemon to a container
+var runtimeSockets = []string{"docker.sock", "containerd.sock", "podman.sock", "crio.sock"}
+
+// where the runtime sockets live, mounting a directory holding one hands over the daemon as well
+var runtimeSocketPaths = []string{
+	"/run/docker.sock", "/var/run/docker.sock", "/run/containerd/containerd.sock", "/var/run/containerd/containerd.sock",
+	"/run/podman/podman.sock", "/var/run/podman/podman.sock", "/run/crio/crio.sock", "/var/run/crio/crio.sock",
+}
+
+// securityCheck is one pass/fail result, cis is the CIS Docker Benchmark recommendation it follows
+type securityCheck struct {
+	name string
+	cis  string
+	pass bool
+}
+
+// setContainerSecurity reports dockerContainerSecuritySample with the container's
+// security relevant settings and a pass/fail per check
+func setContainerSecurity(entity *lib.Entity, inspect types.ContainerJSON) {
+	if !lib.Args.SecurityChecks || inspect.ContainerJSONBase == nil || inspect.HostConfig == nil {
+		return
+	}
+	hostConfig := inspect.HostConfig
+
+	metricSet := lib.NewSample("dockerContainerSecuritySample", entity)
+	lib.SetMetric(metricSet, "hostname", lib.Hostname)
+	lib.SetMetric(metricSet, "containerId", inspect.ID)
+	lib.SetMetric(metricSet, "IDShort", shortID(inspect.ID))
+	lib.SetMetric(metricSet, "containerName", strings.TrimPrefix(inspect.Name, "/"))
+
+	user := ""
+	if inspect.Config != nil {
+		user = inspect.Config.User
+		lib.SetMetric(metricSet, "imageName", inspect.Config.Image)
+	}
+	runsAsRoot := isRootUser(user)
+
+	seccomp, selinux, noNewPrivileges := "default", "", false
+	for _, option := range hostConfig.SecurityOpt {
+		key, val := splitSecurityOpt(option)
+		switch key {
+		case "seccomp":
+			seccomp = val
+		case "label":
+			selinux = strings.TrimSpace(selinux + " " + val)
+		case "no-new-privileges":
+			noNewPrivileges = val == "" || val == "true"
+		}
+	}
+
+	dangerous := []string{}
+	for _, capability := range hostConfig.CapAdd {
+		if dangerousCapabilities[strings.TrimPrefix(strings.ToUpper(capability), "CAP_")] {
+			dangerous = append(dangerous, capability)
+		}
+	}
+
+	sensitive, socketMounted := []string{}, false
+	for _, mount := range inspect.Mounts {
+		if mount.Type != "bind" {
+			continue
+		}
+		source := filepath.Clean(mount.Source)
+		if isSensitiveMount(source) {
+			sensitive = append(sensitive, source)
+		}
+		if isRuntimeSocketMount(source) {
+			socketMounted = true
+		}
+	}
+
+	lib.SetMetric(metricSet, "privileged", hostConfig.Privileged)
+	lib.SetMetric(metricSet, "capAdd", strings.Join(hostConfig.CapAdd, ","))
+	lib.SetMetric(metricSet, "capDrop", strings.Join(hostConfig.CapDrop, ","))
+	lib.SetMetric(metricSet, "dangerousCapabilities", strings.Join(dangerous, ","))
+	lib.SetMetric(metricSet, "seccompProfile", seccomp)
+	lib.SetMetric(metricSet, "apparmorProfile", inspect.AppArmorProfile)
+	lib.SetMetric(metricSet, "selinuxLabel", selinux)
+	lib.SetMetric(metricSet, "user", user)
+	lib.SetMetric(metricSet, "runsAsRoot", runsAsRoot)
+	lib.SetMetric(metricSet, "readonlyRootfs", hostConfig.ReadonlyRootfs)
+	lib.SetMetric(metricSet, "noNewPrivileges", noNewPrivileges)
+	lib.SetMetric(metricSet, "pidMode", string(hostConfig.PidMode))
+	lib.SetMetric(metricSet, "ipcMode", string(hostConfig.IpcMode))
+	lib.SetMetric(metricSet, "networkMode", string(hostConfig.NetworkMode))
+	lib.SetMetric(metricSet, "utsMode", string(hostConfig.UTSMode))
+	lib.SetMetric(metricSet, "usernsMode", string(hostConfig.UsernsMode))
+	lib.SetMetric(metricSet, "runtimeSocketMounted", socketMounted)
+	lib.SetMetric(metricSet, "sensitiveMounts", strings.Join(sensitive, ","))
+	lib.SetMetric(metricSet, "memoryLimit", hostConfig.Memory)
+	lib.SetMetric(metricSet, "nanoCPUs", hostConfig.NanoCPUs)
+	lib.SetMetric(metricSet, "cpuQuota", hostConfig.CPUQuota)
+	pidsLimit := int64(0)
+	if hostConfig.PidsLimit != nil {
+		pidsLimit = *hostConfig.PidsLimit
+	}
+	lib.SetMetric(metricSet, "pidsLimit", pidsLimit)
+
+	checks := []securityCheck{
+		{"nonRootUser", "4.1", !runsAsRoot},
+		{"lsmProfile", "5.1/5.2", (inspect.AppArmorProfile != "" && inspect.AppArmorProfile != "unconfined") || (selinux != "" && !strings.Contains(selinux, "disable"))},
+		{"capabilities", "5.3", len(dangerous) == 0},
+		{"notPrivileged", "5.4", !hostConfig.Privileged},
+		{"noSensitiveMounts", "5.5", len(sensitive) == 0},
+		{"noHostNetwork", "5.9", !hostConfig.NetworkMode.IsHost()},
+		{"memoryLimit", "5.10", hostConfig.Memory > 0},
+		{"cpuLimit", "5.11", hostConfig.NanoCPUs > 0 || hostConfig.CPUQuota > 0 || (hostConfig.CPUShares > 0 && hostConfig.CPUShares != 1024)},
+		{"readonlyRootfs", "5.12", hostConfig.ReadonlyRootfs},
+		{"noHostPid", "5.15", !hostConfig.PidMode.IsHost()},
+		{"noHostIpc", "5.16", !hostConfig.IpcMode.IsHost()},
+		{"noHostUts", "5.20", !hostConfig.UTSMode.IsHost()},
+		{"seccompProfile", "5.21", seccomp != "unconfined"},
+		{"noNewPrivileges", "5.25", noNewPrivileges},
+		{"pidsLimit", "5.28", pidsLimit > 0},
+		{"noHostUserns", "5.30", !hostConfig.UsernsMode.IsHost()},
+		{"noRuntimeSocket", "5.31", !socketMounted},
+	}
+
+	passed, failed := 0, []string{}
+	for _, check := range checks {
+		result := "pass"
+		if check.pass {
+			passed++
+		} else {
+			result = "fail"
+			failed = append(failed, check.name)
+		}
+		lib.SetMetric(metricSet, "check."+check.name, result)
+		lib.SetMetric(metricSet, "check."+check.name+".cis", check.cis)
+	}
+	lib.SetMetric(metricSet, "checksPassed", passed)
+	lib.SetMetric(metricSet, "checksFailed", len(failed))
+	lib.SetMetric(metricSet, "failedChecks", strings.Join(failed, ","))
+}
+
+// isSensitiveMount is true for a sensitive host path or a path below one, eg. /etc/shadow.
+// Everything is below /, so only / itself counts for it.
+func isSensitiveMount(source string) bool {
+	for _, path := range sensitiveHostPaths {
+		if source == path || (path != "/" && strings.HasPrefix(source, path+"/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// isRuntimeSocketMount is true for a runtime socket wherever it lives, eg. a rootless
+// /run/user/1000/docker.sock, and for a directory holding a well known one such as /var/run
+func isRuntimeSocketMount(source string) bool {
+	for _, socket := range runtimeSockets {
+		if filepath.Base(source) == socket {
+			return true
+		}
+	}
+	for _, path := range runtimeSocketPaths {
+		if source == "/" || strings.HasPrefix(path, source+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// isRootUser is true for an empty user, root or uid 0, with or without a group
+func isRootUser(user string) bool {
+	name := strings.SplitN(user, ":", 2)[0]
+	return name == "" || name == "root" || name == "0"
+}
+
+// splitSecurityOpt splits seccomp=x, seccomp:x (pre 1.12 syntax) and bare flags
+func splitSecurityOpt(option string) (string, string) {
+	if i := strings.IndexAny(option, "=:"); i >= 0 {
+		return option[:i], option[i+1:]
+	}
+	return option, ""
+}
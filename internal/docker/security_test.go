@@ -0,0 +1,85 @@
+package nrdocker
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/newrelic-experimental/nri-docker/internal/lib"
+)
+
+func TestMountChecks(t *testing.T) {
+	tests := []struct {
+		source    string
+		sensitive bool
+		socket    bool
+	}{
+		{"/", true, true},
+		{"/etc", true, false},
+		{"/etc/shadow", true, false},
+		{"/etcetera", false, false},
+		{"/proc/1/ns", true, false},
+		{"/dev/log", true, false},
+		{"/var/lib/docker/volumes/data/_data", true, false},
+		{"/var/lib/dockerd", false, false},
+		{"/var/run/docker.sock", false, true},
+		{"/run/user/1000/docker.sock", false, true},
+		{"/host/var/run/docker.sock", false, true},
+		{"/run/containerd/containerd.sock", false, true},
+		{"/var/run", false, true},
+		{"/run/containerd", false, true},
+		{"/run/mydocker.sock", false, false},
+		{"/srv/app/data", false, false},
+		{"/home/dev/.docker/config.json", false, false},
+	}
+	for _, tt := range tests {
+		if got := isSensitiveMount(tt.source); got != tt.sensitive {
+			t.Errorf("%s sensitive %v, want %v", tt.source, got, tt.sensitive)
+		}
+		if got := isRuntimeSocketMount(tt.source); got != tt.socket {
+			t.Errorf("%s a runtime socket %v, want %v", tt.source, got, tt.socket)
+		}
+	}
+}
+
+func TestSetContainerSecurity(t *testing.T) {
+	defer func(checks bool) { lib.Args.SecurityChecks = checks }(lib.Args.SecurityChecks)
+	lib.Args.SecurityChecks = true
+	inspect := types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			ID:         "4fa6e0f0c678",
+			Name:       "/agent",
+			HostConfig: &container.HostConfig{CapAdd: []string{"SYS_ADMIN", "CHOWN"}, SecurityOpt: []string{"no-new-privileges"}},
+		},
+		Config: &container.Config{User: "1000:1000", Image: "agent:1"},
+		Mounts: []types.MountPoint{
+			{Type: "bind", Source: "/etc/shadow", Destination: "/shadow"},
+			{Type: "bind", Source: "/host/var/run/docker.sock", Destination: "/var/run/docker.sock"},
+			{Type: "bind", Source: "/srv/app/", Destination: "/app"},
+			{Type: "volume", Source: "/var/lib/docker/volumes/data/_data", Destination: "/data"},
+		},
+	}
+	entity := lib.NewPayload().LocalEntity()
+	setContainerSecurity(entity, inspect)
+	if len(entity.Samples) != 1 {
+		t.Fatalf("%d samples", len(entity.Samples))
+	}
+	metrics := entity.Samples[0].Metrics
+	want := map[string]interface{}{
+		"sensitiveMounts":             "/etc/shadow",
+		"runtimeSocketMounted":        "true",
+		"dangerousCapabilities":       "SYS_ADMIN",
+		"runsAsRoot":                  "false",
+		"noNewPrivileges":             "true",
+		"check.noSensitiveMounts":     "fail",
+		"check.noRuntimeSocket":       "fail",
+		"check.capabilities":          "fail",
+		"check.nonRootUser":           "pass",
+		"check.noSensitiveMounts.cis": "5.5",
+	}
+	for key, val := range want {
+		if metrics[key] != val {
+			t.Errorf("%s = %v, want %v", key, metrics[key], val)
+		}
+	}
+}
@@ -9,8 +9,8 @@ import (
 	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/swarm"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
 	"github.com/newrelic-experimental/nri-docker/internal/lib"
-	"github.com/newrelic/infra-integrations-sdk/integration"
 	"vbom.ml/util/sortorder"
 )
 
@@ -37,11 +37,18 @@ type Namespace struct {
 }
 
 // GetServices x
-func GetServices(cli *client.Client, entity *integration.Entity) {
-	ctx := context.Background()
-	services, err := cli.ServiceList(ctx, types.ServiceListOptions{})
-
-	if err == nil {
+func GetServices(ctx context.Context, cli *client.Client, entity *lib.Entity) {
+	callCtx, cancel := lib.CallContext(ctx)
+	services, err := cli.ServiceList(callCtx, types.ServiceListOptions{})
+	err = lib.WrapError(callCtx, "services", "/services", "", err)
+	cancel()
+
+	if err != nil {
+		// nodes outside a swarm, or swarm workers, cannot list services
+		if lib.SwarmState == "active" && !errdefs.IsUnavailable(err) {
+			lib.ReportError(entity, err)
+		}
+	} else {
 		sort.Slice(services, func(i, j int) bool {
 			return sortorder.NaturalLess(services[i].Spec.Name, services[j].Spec.Name)
 		})
@@ -51,13 +58,19 @@ func GetServices(cli *client.Client, entity *integration.Entity) {
 			for _, service := range services {
 				taskFilter.Add("service", service.ID)
 			}
-			tasks, err := cli.TaskList(ctx, types.TaskListOptions{Filters: taskFilter})
+			callCtx, cancel := lib.CallContext(ctx)
+			tasks, err := cli.TaskList(callCtx, types.TaskListOptions{Filters: taskFilter})
+			err = lib.WrapError(callCtx, "services", "/tasks", "", err)
+			cancel()
 			if err != nil {
-				lib.ErrorLogToInsights(err, entity)
+				lib.ReportError(entity, err)
 			}
-			nodes, err := cli.NodeList(ctx, types.NodeListOptions{})
+			callCtx, cancel = lib.CallContext(ctx)
+			nodes, err := cli.NodeList(callCtx, types.NodeListOptions{})
+			err = lib.WrapError(callCtx, "services", "/nodes", "", err)
+			cancel()
 			if err != nil {
-				lib.ErrorLogToInsights(err, entity)
+				lib.ReportError(entity, err)
 			}
 			if err == nil {
 				GetServicesStatus(services, nodes, tasks, entity)
@@ -67,7 +80,7 @@ func GetServices(cli *client.Client, entity *integration.Entity) {
 }
 
 // GetServicesStatus x
-func GetServicesStatus(services []swarm.Service, nodes []swarm.Node, tasks []swarm.Task, entity *integration.Entity) {
+func GetServicesStatus(services []swarm.Service, nodes []swarm.Node, tasks []swarm.Task, entity *lib.Entity) {
 	running := map[string]int{}
 	tasksNoShutdown := map[string]int{}
 
@@ -89,7 +102,7 @@ func GetServicesStatus(services []swarm.Service, nodes []swarm.Node, tasks []swa
 
 	m := make(map[string]*Stack)
 	for _, service := range services {
-		metricSet := lib.NewMetricSet("dockerServiceSample", entity)
+		metricSet := lib.NewSample("dockerServiceSample", entity)
 		lib.SetMetric(metricSet, "serviceID", service.ID)
 		lib.SetMetric(metricSet, "name", service.Spec.Name)
 		lib.SetMetric(metricSet, "createdAt", service.CreatedAt.Unix())
@@ -146,7 +159,7 @@ func GetServicesStatus(services []swarm.Service, nodes []swarm.Node, tasks []swa
 	}
 
 	for stack, val := range m {
-		metricSet := lib.NewMetricSet("dockerStackSample", entity)
+		metricSet := lib.NewSample("dockerStackSample", entity)
 		lib.SetMetric(metricSet, "name", stack)
 		lib.SetMetric(metricSet, "services", val.Services)
 	}
@@ -0,0 +1,21 @@
+//go:build linux
+// +build linux
+
+package nrdocker
+
+import "syscall"
+
+func statFS(path string) (fsUsage, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return fsUsage{}, err
+	}
+	blockSize := uint64(stat.Bsize)
+	return fsUsage{
+		Total:      stat.Blocks * blockSize,
+		Free:       stat.Bfree * blockSize,
+		Available:  stat.Bavail * blockSize,
+		Inodes:     stat.Files,
+		InodesFree: stat.Ffree,
+	}, nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package nrdocker
+
+import "errors"
+
+func statFS(path string) (fsUsage, error) {
+	return fsUsage{}, errors.New("filesystem usage is only collected on linux")
+}
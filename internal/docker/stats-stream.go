@@ -0,0 +1,238 @@
+package nrdocker
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+	log "github.com/newrelic/infra-integrations-sdk/log"
+)
+
+// streamers are set per client when running as a daemon, FetchStats then reads
+// from them instead of issuing one blocking stats call per container
+var streamers = map[*client.Client]*StatsStreamer{}
+var streamersLock sync.Mutex
+
+// StatsStreamer keeps a stream=true stats subscription open for every running
+// container and aggregates the readings received between two reports
+type StatsStreamer struct {
+	cli        *client.Client
+	lock       sync.Mutex
+	containers map[string]*streamedStats
+}
+
+type streamedStats struct {
+	cancel   context.CancelFunc
+	osType   string
+	latest   types.StatsJSON
+	received bool
+	cpu      aggregate
+	mem      aggregate
+}
+
+// aggregate tracks min/avg/max of a reading within a reporting interval
+type aggregate struct {
+	min   float64
+	max   float64
+	sum   float64
+	count int
+}
+
+func (a *aggregate) add(v float64) {
+	if a.count == 0 || v < a.min {
+		a.min = v
+	}
+	if a.count == 0 || v > a.max {
+		a.max = v
+	}
+	a.sum += v
+	a.count++
+}
+
+func (a aggregate) avg() float64 {
+	if a.count == 0 {
+		return 0
+	}
+	return a.sum / float64(a.count)
+}
+
+// StartStatsStreaming subscribes to the stats of every running container and
+// follows container start and die events until ctx is cancelled
+func StartStatsStreaming(ctx context.Context, cli *client.Client) *StatsStreamer {
+	s := &StatsStreamer{cli: cli, containers: map[string]*streamedStats{}}
+	streamersLock.Lock()
+	streamers[cli] = s
+	streamersLock.Unlock()
+	go s.watchEvents(ctx)
+	return s
+}
+
+// watchEvents resyncs the subscriptions with the running containers and then
+// follows the event stream, reconnecting whenever it breaks
+func (s *StatsStreamer) watchEvents(ctx context.Context) {
+	for {
+		eventFilter := filters.NewArgs()
+		eventFilter.Add("type", "container")
+		eventFilter.Add("event", "start")
+		eventFilter.Add("event", "die")
+		eventFilter.Add("event", "destroy")
+		messages, errs := s.cli.Events(ctx, types.EventsOptions{Filters: eventFilter})
+
+		s.resync(ctx)
+
+	stream:
+		for {
+			select {
+			case msg := <-messages:
+				switch msg.Action {
+				case "start":
+					s.subscribe(ctx, msg.Actor.ID)
+				case "die", "destroy":
+					s.unsubscribe(msg.Actor.ID)
+				}
+			case err := <-errs:
+				if ctx.Err() != nil {
+					return
+				}
+				log.Debug("docker event stream closed: %v", err)
+				break stream
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+func (s *StatsStreamer) resync(ctx context.Context) {
+	containers, err := s.cli.ContainerList(ctx, types.ContainerListOptions{})
+	if err != nil {
+		log.Debug(err.Error())
+		return
+	}
+
+	running := map[string]bool{}
+	for _, container := range containers {
+		running[container.ID] = true
+		s.subscribe(ctx, container.ID)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for id, st := range s.containers {
+		if !running[id] {
+			st.cancel()
+			delete(s.containers, id)
+		}
+	}
+}
+
+func (s *StatsStreamer) subscribe(ctx context.Context, id string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, ok := s.containers[id]; ok {
+		return
+	}
+	streamCtx, cancel := context.WithCancel(ctx)
+	st := &streamedStats{cancel: cancel}
+	s.containers[id] = st
+	go s.stream(streamCtx, id, st)
+}
+
+func (s *StatsStreamer) unsubscribe(id string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if st, ok := s.containers[id]; ok {
+		st.cancel()
+		delete(s.containers, id)
+	}
+}
+
+func (s *StatsStreamer) stream(ctx context.Context, id string, st *streamedStats) {
+	defer s.unsubscribeIfCurrent(id, st)
+
+	stats, err := s.cli.ContainerStats(ctx, id, true)
+	if err != nil {
+		log.Debug(err.Error())
+		return
+	}
+	defer stats.Body.Close()
+	s.consume(st, stats.OSType, json.NewDecoder(stats.Body))
+}
+
+// statsDecoder reads one stats reading at a time, a json.Decoder over a stream=true response
+type statsDecoder interface {
+	Decode(v interface{}) error
+}
+
+// consume aggregates every reading of decoder into st until the stream ends
+func (s *StatsStreamer) consume(st *streamedStats, osType string, decoder statsDecoder) {
+	for {
+		var containerStats types.StatsJSON
+		if err := decoder.Decode(&containerStats); err != nil {
+			return
+		}
+
+		var cpu, mem float64
+		if osType == "windows" {
+			cpu = calculateCPUPercentWindows(containerStats)
+			mem = float64(containerStats.MemoryStats.PrivateWorkingSet)
+		} else {
+			cpu = calculateCPUPercentUnix(containerStats.PreCPUStats.CPUUsage.TotalUsage, containerStats.PreCPUStats.SystemUsage, containerStats)
+			mem = calculateMemUsageUnixNoCache(containerStats.MemoryStats)
+		}
+
+		s.lock.Lock()
+		st.osType = osType
+		st.latest = containerStats
+		st.received = true
+		// the very first reading has no previous cpu sample to compare against
+		if containerStats.PreCPUStats.SystemUsage != 0 || osType == "windows" {
+			st.cpu.add(cpu)
+		}
+		st.mem.add(mem)
+		s.lock.Unlock()
+	}
+}
+
+// unsubscribeIfCurrent drops a finished stream unless it was already replaced by a newer subscription
+func (s *StatsStreamer) unsubscribeIfCurrent(id string, st *streamedStats) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.containers[id] == st {
+		st.cancel()
+		delete(s.containers, id)
+	}
+}
+
+// snapshot returns the latest reading of a container with the aggregates since
+// the previous snapshot, and starts a new aggregation interval
+func (s *StatsStreamer) snapshot(id string) (types.StatsJSON, string, aggregate, aggregate, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	st, ok := s.containers[id]
+	if !ok || !st.received {
+		return types.StatsJSON{}, "", aggregate{}, aggregate{}, false
+	}
+	cpu, mem := st.cpu, st.mem
+	st.cpu, st.mem = aggregate{}, aggregate{}
+	return st.latest, st.osType, cpu, mem, true
+}
+
+// streamedSnapshot reads from the daemon mode streamer of cli, ok is false when there is none or it has no reading yet
+func streamedSnapshot(cli *client.Client, id string) (types.StatsJSON, string, aggregate, aggregate, bool) {
+	streamersLock.Lock()
+	streamer := streamers[cli]
+	streamersLock.Unlock()
+	if streamer == nil {
+		return types.StatsJSON{}, "", aggregate{}, aggregate{}, false
+	}
+	return streamer.snapshot(id)
+}
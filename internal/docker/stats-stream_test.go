@@ -0,0 +1,177 @@
+package nrdocker
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+// fakeDecoder hands out readings like a stream=true response, then ends the stream
+type fakeDecoder struct {
+	readings []types.StatsJSON
+}
+
+func (d *fakeDecoder) Decode(v interface{}) error {
+	if len(d.readings) == 0 {
+		return io.EOF
+	}
+	*v.(*types.StatsJSON) = d.readings[0]
+	d.readings = d.readings[1:]
+	return nil
+}
+
+// reading is a linux stats reading, cpu and system usage in ns with the previous ones
+func reading(cpu, system, preCPU, preSystem, mem uint64) types.StatsJSON {
+	stats := types.StatsJSON{}
+	stats.CPUStats.CPUUsage.TotalUsage = cpu
+	stats.CPUStats.SystemUsage = system
+	stats.CPUStats.OnlineCPUs = 2
+	stats.PreCPUStats.CPUUsage.TotalUsage = preCPU
+	stats.PreCPUStats.SystemUsage = preSystem
+	stats.MemoryStats.Usage = mem
+	stats.MemoryStats.Stats = map[string]uint64{"inactive_file": 0}
+	return stats
+}
+
+func TestStreamAggregation(t *testing.T) {
+	s := &StatsStreamer{containers: map[string]*streamedStats{}}
+	st := &streamedStats{cancel: func() {}}
+	s.containers["web"] = st
+	if _, _, _, _, ok := s.snapshot("web"); ok {
+		t.Error("a snapshot before the first reading")
+	}
+
+	ticks := []struct {
+		readings []types.StatsJSON
+		cpu      aggregate
+		mem      aggregate
+		latest   uint64
+	}{
+		{
+			// the first reading has no previous cpu reading, 20% and 10% of 2 cpus after it
+			readings: []types.StatsJSON{
+				reading(1e9, 10e9, 0, 0, 100e6),
+				reading(2e9, 20e9, 1e9, 10e9, 120e6),
+				reading(2.5e9, 30e9, 2e9, 20e9, 110e6),
+			},
+			cpu:    aggregate{min: 10, max: 20, sum: 30, count: 2},
+			mem:    aggregate{min: 100e6, max: 120e6, sum: 330e6, count: 3},
+			latest: 110e6,
+		},
+		// no reading since the previous tick keeps the latest one and resets the aggregates
+		{latest: 110e6},
+		{
+			readings: []types.StatsJSON{reading(3e9, 40e9, 2.5e9, 30e9, 90e6)},
+			cpu:      aggregate{min: 10, max: 10, sum: 10, count: 1},
+			mem:      aggregate{min: 90e6, max: 90e6, sum: 90e6, count: 1},
+			latest:   90e6,
+		},
+	}
+	for i, tick := range ticks {
+		s.consume(st, "linux", &fakeDecoder{readings: tick.readings})
+		latest, osType, cpu, mem, ok := s.snapshot("web")
+		if !ok || osType != "linux" || latest.MemoryStats.Usage != tick.latest {
+			t.Errorf("tick %d: snapshot %v on %q with %d bytes, want %d", i, ok, osType, latest.MemoryStats.Usage, tick.latest)
+		}
+		if cpu != tick.cpu {
+			t.Errorf("tick %d: cpu %+v, want %+v", i, cpu, tick.cpu)
+		}
+		if mem != tick.mem {
+			t.Errorf("tick %d: mem %+v, want %+v", i, mem, tick.mem)
+		}
+	}
+	if avg := ticks[0].cpu.avg(); avg != 15 {
+		t.Errorf("cpu avg %v", avg)
+	}
+}
+
+// statsDaemon streams stats readings, ending the first stream of a container as if it went
+// away and keeping later ones open until the request is cancelled
+type statsDaemon struct {
+	lock     sync.Mutex
+	requests int
+}
+
+func (d *statsDaemon) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := versionPrefix.ReplaceAllString(r.URL.Path, "")
+	w.Header().Set("API-Version", "1.41")
+	w.Header().Set("Content-Type", "application/json")
+	if path != "/containers/web/stats" {
+		http.NotFound(w, r)
+		return
+	}
+	d.lock.Lock()
+	d.requests++
+	first := d.requests == 1
+	d.lock.Unlock()
+
+	encoder := json.NewEncoder(w)
+	encoder.Encode(reading(1e9, 10e9, 0, 0, 100e6))
+	encoder.Encode(reading(2e9, 20e9, 1e9, 10e9, 120e6))
+	w.(http.Flusher).Flush()
+	if !first {
+		<-r.Context().Done()
+	}
+}
+
+func TestStreamRestart(t *testing.T) {
+	daemon := &statsDaemon{}
+	server := httptest.NewServer(daemon)
+	defer server.Close()
+	cli, err := Endpoint{Host: "tcp://" + server.Listener.Addr().String()}.NewClient("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := &StatsStreamer{cli: cli, containers: map[string]*streamedStats{}}
+	current := func() *streamedStats {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		return s.containers["web"]
+	}
+	wait := func(what string, done func() bool) {
+		for deadline := time.Now().Add(5 * time.Second); !done(); {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s", what)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	s.subscribe(ctx, "web")
+	gone := current()
+	wait("the ended stream to be dropped", func() bool { return current() == nil })
+	if _, _, _, _, ok := s.snapshot("web"); ok {
+		t.Error("a snapshot of a container that went away")
+	}
+
+	// started again
+	s.subscribe(ctx, "web")
+	wait("a reading of the new stream", func() bool {
+		_, _, _, mem, ok := s.snapshot("web")
+		return ok && mem.count > 0
+	})
+	// the stream that ended before must not drop its replacement
+	s.unsubscribeIfCurrent("web", gone)
+	if st := current(); st == nil || st == gone {
+		t.Error("the new stream was dropped")
+	}
+	daemon.lock.Lock()
+	if daemon.requests != 2 {
+		t.Errorf("%d stats requests, want 2", daemon.requests)
+	}
+	daemon.lock.Unlock()
+
+	s.unsubscribe("web")
+	if current() != nil {
+		t.Error("unsubscribed container still streamed")
+	}
+}
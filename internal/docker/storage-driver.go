@@ -0,0 +1,93 @@
+package nrdocker
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/go-units"
+	"github.com/newrelic-experimental/nri-docker/internal/lib"
+)
+
+// DriverStatus keys holding a human readable size, eg. devicemapper "Data Space Used: 1.2 GB"
+var sizeKeyWords = []string{"Space", "Size", "Blocksize", "Quota"}
+
+// setStorageDriverMetrics reports dockerStorageDriverSample from the storage driver's
+// status in /info, sizes are converted to bytes and devicemapper pools get usage percentages
+func setStorageDriverMetrics(entity *lib.Entity, info types.Info) {
+	if len(info.DriverStatus) == 0 {
+		return
+	}
+	metricSet := lib.NewSample("dockerStorageDriverSample", entity)
+	lib.SetMetric(metricSet, "hostname", lib.Hostname)
+	lib.SetMetric(metricSet, "storageDriver", info.Driver)
+	lib.SetMetric(metricSet, "dockerRootDir", info.DockerRootDir)
+
+	sizes := map[string]float64{}
+	for _, status := range info.DriverStatus {
+		if len(status) < 2 {
+			continue
+		}
+		key, val := driverStatusKey(status[0]), strings.TrimSpace(status[1])
+		if key == "" {
+			continue
+		}
+		switch {
+		case isSizeKey(status[0]):
+			size, err := units.FromHumanSize(val)
+			if err != nil {
+				// eg. zfs "Parent Quota: no"
+				lib.SetMetric(metricSet, key, val)
+				continue
+			}
+			sizes[key] = float64(size)
+			lib.SetMetric(metricSet, key+"Bytes", float64(size))
+		case val == "true" || val == "false":
+			lib.SetMetric(metricSet, key, val == "true")
+		case strings.HasSuffix(key, "Count"):
+			if count, err := strconv.ParseInt(val, 10, 64); err == nil {
+				lib.SetMetric(metricSet, key, count)
+			}
+		default:
+			lib.SetMetric(metricSet, key, val)
+		}
+	}
+
+	// devicemapper thin pools stop accepting writes once data or metadata space runs out
+	for _, space := range []string{"data", "metadata"} {
+		used, total := sizes[space+"SpaceUsed"], sizes[space+"SpaceTotal"]
+		if total > 0 {
+			lib.SetMetric(metricSet, space+"SpaceUsedPercent", used/total*100)
+		}
+	}
+	if minimum, ok := sizes["thinPoolMinimumFreeSpace"]; ok {
+		if available, ok := sizes["dataSpaceAvailable"]; ok {
+			lib.SetMetric(metricSet, "thinPoolLowSpace", available < minimum)
+		}
+	}
+}
+
+func isSizeKey(key string) bool {
+	for _, word := range sizeKeyWords {
+		if strings.Contains(key, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// driverStatusKey turns "Data Space Used" into dataSpaceUsed and "Supports d_type" into supportsDType
+func driverStatusKey(key string) string {
+	words := strings.FieldsFunc(key, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, word := range words {
+		if i == 0 {
+			words[i] = strings.ToLower(word[:1]) + word[1:]
+		} else {
+			words[i] = strings.ToUpper(word[:1]) + word[1:]
+		}
+	}
+	return strings.Join(words, "")
+}
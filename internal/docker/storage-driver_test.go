@@ -0,0 +1,104 @@
+package nrdocker
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/newrelic-experimental/nri-docker/internal/lib"
+)
+
+func TestDriverStatusKey(t *testing.T) {
+	tests := []struct {
+		status string
+		key    string
+	}{
+		{"Data Space Used", "dataSpaceUsed"},
+		{"Supports d_type", "supportsDType"},
+		{"Backing Filesystem", "backingFilesystem"},
+		{"Native Overlay Diff", "nativeOverlayDiff"},
+		{"userxattr", "userxattr"},
+		{"Zpool Health", "zpoolHealth"},
+		{" : ", ""},
+	}
+	for _, tt := range tests {
+		if got := driverStatusKey(tt.status); got != tt.key {
+			t.Errorf("driverStatusKey(%q) = %q, want %q", tt.status, got, tt.key)
+		}
+	}
+}
+
+func TestSetStorageDriverMetrics(t *testing.T) {
+	tests := []struct {
+		name    string
+		driver  string
+		status  [][2]string
+		metrics map[string]interface{}
+	}{
+		{
+			name:   "overlay2",
+			driver: "overlay2",
+			status: [][2]string{{"Backing Filesystem", "extfs"}, {"Supports d_type", "true"}, {"Native Overlay Diff", "false"}, {"userxattr", "false"}},
+			metrics: map[string]interface{}{
+				"storageDriver":     "overlay2",
+				"backingFilesystem": "extfs",
+				"supportsDType":     "true",
+				"nativeOverlayDiff": "false",
+			},
+		},
+		{
+			name:   "devicemapper low on space",
+			driver: "devicemapper",
+			status: [][2]string{
+				{"Pool Name", "docker-thinpool"},
+				{"Pool Blocksize", "524.3kB"},
+				{"Data Space Used", "90GB"},
+				{"Data Space Total", "100GB"},
+				{"Data Space Available", "10GB"},
+				{"Metadata Space Used", "1GB"},
+				{"Metadata Space Total", "4GB"},
+				{"Thin Pool Minimum Free Space", "10.5GB"},
+				{"Deferred Deleted Device Count", "3"},
+			},
+			metrics: map[string]interface{}{
+				"poolName":                      "docker-thinpool",
+				"poolBlocksizeBytes":            float64(524300),
+				"dataSpaceUsedBytes":            float64(90e9),
+				"dataSpaceUsedPercent":          float64(90),
+				"metadataSpaceUsedPercent":      float64(25),
+				"thinPoolMinimumFreeSpaceBytes": float64(10.5e9),
+				"thinPoolLowSpace":              "true",
+				"deferredDeletedDeviceCount":    float64(3),
+			},
+		},
+		{
+			name:   "zfs without quota",
+			driver: "zfs",
+			status: [][2]string{{"Zpool", "tank"}, {"Parent Quota", "no"}, {"Compression", "lz4"}},
+			metrics: map[string]interface{}{
+				"zpool":       "tank",
+				"parentQuota": "no",
+				"compression": "lz4",
+			},
+		},
+	}
+	for _, tt := range tests {
+		info := types.Info{Driver: tt.driver, DockerRootDir: "/var/lib/docker", DriverStatus: tt.status}
+		entity := lib.NewPayload().LocalEntity()
+		setStorageDriverMetrics(entity, info)
+		if len(entity.Samples) != 1 {
+			t.Fatalf("%s: %d samples", tt.name, len(entity.Samples))
+		}
+		metrics := entity.Samples[0].Metrics
+		for key, want := range tt.metrics {
+			if metrics[key] != want {
+				t.Errorf("%s: %s = %v (%T), want %v", tt.name, key, metrics[key], metrics[key], want)
+			}
+		}
+	}
+
+	entity := lib.NewPayload().LocalEntity()
+	setStorageDriverMetrics(entity, types.Info{Driver: "vfs"})
+	if len(entity.Samples) != 0 {
+		t.Errorf("a driver without status reported %v", entity.Samples[0].Metrics)
+	}
+}
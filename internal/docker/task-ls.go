@@ -8,19 +8,18 @@ import (
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/client"
 	"github.com/newrelic-experimental/nri-docker/internal/lib"
-	"github.com/newrelic/infra-integrations-sdk/integration"
-	log "github.com/newrelic/infra-integrations-sdk/log"
 )
 
 // GetTasks x
-func GetTasks(cli *client.Client, entity *integration.Entity) {
-	ctx := context.Background()
-	tasks, err := cli.TaskList(ctx, types.TaskListOptions{})
+func GetTasks(ctx context.Context, cli *client.Client, entity *lib.Entity) {
+	callCtx, cancel := lib.CallContext(ctx)
+	defer cancel()
+	tasks, err := cli.TaskList(callCtx, types.TaskListOptions{})
 	if err != nil {
-		log.Debug(err.Error())
+		lib.ReportError(entity, lib.WrapError(callCtx, "tasks", "/tasks", "", err))
 	} else {
 		for _, task := range tasks {
-			metricSet := lib.NewMetricSet("dockerTaskSample", entity)
+			metricSet := lib.NewSample("dockerTaskSample", entity)
 			lib.SetMetric(metricSet, "taskID", task.ID)
 			lib.SetMetric(metricSet, "nodeID", task.NodeID)
 			lib.SetMetric(metricSet, "serviceID", task.ServiceID)
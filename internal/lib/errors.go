@@ -0,0 +1,137 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+	log "github.com/newrelic/infra-integrations-sdk/log"
+)
+
+// ErrorKind classifies why a collection step failed
+type ErrorKind string
+
+// Error kinds reported as errorType on dockerIntegrationError
+const (
+	ErrorConnection ErrorKind = "connection"
+	ErrorPermission ErrorKind = "permission"
+	ErrorAPIVersion ErrorKind = "apiVersion"
+	ErrorTimeout    ErrorKind = "timeout"
+	ErrorDecode     ErrorKind = "decode"
+	ErrorNotFound   ErrorKind = "notFound"
+	ErrorDaemon     ErrorKind = "daemon"
+	ErrorUnknown    ErrorKind = "unknown"
+)
+
+// CollectorError is an error annotated with where it happened and whether retrying may help
+type CollectorError struct {
+	Kind        ErrorKind
+	Collector   string
+	Endpoint    string
+	ContainerID string
+	Retryable   bool
+	Err         error
+}
+
+func (e *CollectorError) Error() string {
+	msg := fmt.Sprintf("%s %s: %v", e.Collector, e.Endpoint, e.Err)
+	if e.ContainerID != "" {
+		msg = fmt.Sprintf("%s %s (container %s): %v", e.Collector, e.Endpoint, e.ContainerID, e.Err)
+	}
+	return msg
+}
+
+// Cause returns the underlying error, letting errdefs helpers see through the wrapper
+func (e *CollectorError) Cause() error {
+	return e.Err
+}
+
+// WrapError classifies err into a CollectorError, it returns nil when err is nil.
+// ctx is the context the failed call ran with: the docker client reports deadline
+// hits as connection failures, so the context is what tells a timeout apart.
+func WrapError(ctx context.Context, collector, endpoint, containerID string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if ce, ok := err.(*CollectorError); ok {
+		return ce
+	}
+	kind, retryable := classify(err)
+	if ctx != nil && ctx.Err() != nil {
+		kind, retryable = ErrorTimeout, true
+	}
+	return &CollectorError{
+		Kind:        kind,
+		Collector:   collector,
+		Endpoint:    endpoint,
+		ContainerID: containerID,
+		Retryable:   retryable,
+		Err:         err,
+	}
+}
+
+// ErrorKindOf returns the kind of a CollectorError, or classifies a plain error
+func ErrorKindOf(err error) ErrorKind {
+	if ce, ok := err.(*CollectorError); ok {
+		return ce.Kind
+	}
+	kind, _ := classify(err)
+	return kind
+}
+
+func classify(err error) (ErrorKind, bool) {
+	var opErr *net.OpError
+	msg := strings.ToLower(err.Error())
+	switch err.(type) {
+	case *json.SyntaxError, *json.UnmarshalTypeError:
+		return ErrorDecode, true
+	}
+	switch {
+	case IsTimeout(err) || errdefs.IsDeadline(err):
+		return ErrorTimeout, true
+	case errdefs.IsUnauthorized(err) || errdefs.IsForbidden(err) || strings.Contains(msg, "permission denied"):
+		return ErrorPermission, false
+	case client.IsErrConnectionFailed(err) || strings.Contains(msg, "error during connect") || errors.As(err, &opErr):
+		return ErrorConnection, true
+	case strings.Contains(msg, "client version") || strings.Contains(msg, "api version") || errdefs.IsNotImplemented(err):
+		return ErrorAPIVersion, false
+	case err == io.ErrUnexpectedEOF || strings.Contains(msg, "error reading json"):
+		return ErrorDecode, true
+	case client.IsErrNotFound(err):
+		return ErrorNotFound, false
+	case errdefs.IsUnavailable(err) || errdefs.IsSystem(err):
+		return ErrorDaemon, true
+	}
+	return ErrorUnknown, false
+}
+
+// ReportError logs err and records it as a dockerIntegrationError sample, so a
+// failing call costs its own data rather than the whole run
+func ReportError(entity *Entity, err error) {
+	if err == nil {
+		return
+	}
+	log.Warn("%v", err)
+
+	errorMetricSet := entity.NewSample("dockerIntegrationError")
+	errorMetricSet.Metrics["errorMsg"] = Redact(err.Error())
+	errorMetricSet.Metrics["hostname"] = Hostname
+
+	ce, ok := err.(*CollectorError)
+	if !ok {
+		kind, retryable := classify(err)
+		ce = &CollectorError{Kind: kind, Retryable: retryable, Err: err}
+	}
+	Self.CountError(ce.Kind)
+	errorMetricSet.Metrics["errorType"] = string(ce.Kind)
+	errorMetricSet.Metrics["retryable"] = fmt.Sprintf("%v", ce.Retryable)
+	SetMetric(errorMetricSet, "collector", ce.Collector)
+	SetMetric(errorMetricSet, "endpoint", ce.Endpoint)
+	SetMetric(errorMetricSet, "containerId", ce.ContainerID)
+}
@@ -0,0 +1,65 @@
+package lib
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/docker/docker/errdefs"
+)
+
+func TestWrapError(t *testing.T) {
+	expired, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	syntax := json.Unmarshal([]byte("{"), &struct{}{})
+
+	tests := []struct {
+		name      string
+		ctx       context.Context
+		err       error
+		kind      ErrorKind
+		retryable bool
+	}{
+		{"deadline", nil, context.DeadlineExceeded, ErrorTimeout, true},
+		// the docker client reports a deadline hit as a failed connection
+		{"expired call context", expired, errors.New("error during connect: Get http://docker/containers/json: context deadline exceeded"), ErrorTimeout, true},
+		{"expired call context and another error", expired, errdefs.NotFound(errors.New("no such container")), ErrorTimeout, true},
+		{"connection refused", nil, &net.OpError{Op: "dial", Net: "unix", Err: errors.New("connect: connection refused")}, ErrorConnection, true},
+		{"daemon not running", nil, errors.New("Cannot connect to the Docker daemon at unix:///var/run/docker.sock. Is the docker daemon running?: error during connect"), ErrorConnection, true},
+		{"socket permission", nil, errors.New("Got permission denied while trying to connect to the Docker daemon socket"), ErrorPermission, false},
+		{"forbidden", nil, errdefs.Forbidden(errors.New("authorization denied by plugin")), ErrorPermission, false},
+		{"api version", nil, errors.New("Error response from daemon: client version 1.43 is too new. Maximum supported API version is 1.41"), ErrorAPIVersion, false},
+		{"not implemented", nil, errdefs.NotImplemented(errors.New("not implemented")), ErrorAPIVersion, false},
+		{"json syntax", nil, syntax, ErrorDecode, true},
+		{"truncated body", nil, io.ErrUnexpectedEOF, ErrorDecode, true},
+		{"not found", nil, errdefs.NotFound(errors.New("No such container: 4fa6e0f0c678")), ErrorNotFound, false},
+		{"daemon unavailable", nil, errdefs.Unavailable(errors.New("swarm is not active")), ErrorDaemon, true},
+		{"daemon error", nil, errdefs.System(errors.New("cannot read cgroup")), ErrorDaemon, true},
+		{"anything else", nil, fmt.Errorf("unexpected"), ErrorUnknown, false},
+	}
+	for _, tt := range tests {
+		err := WrapError(tt.ctx, "containers", "/containers/json", "4fa6e0f0c678", tt.err)
+		ce, ok := err.(*CollectorError)
+		if !ok {
+			t.Errorf("%s: %T", tt.name, err)
+			continue
+		}
+		if ce.Kind != tt.kind || ce.Retryable != tt.retryable {
+			t.Errorf("%s: %s retryable %v, want %s retryable %v", tt.name, ce.Kind, ce.Retryable, tt.kind, tt.retryable)
+		}
+		if ErrorKindOf(err) != tt.kind {
+			t.Errorf("%s: ErrorKindOf %s", tt.name, ErrorKindOf(err))
+		}
+		// wrapping again keeps the first classification
+		if again := WrapError(nil, "other", "", "", err); again != err {
+			t.Errorf("%s: wrapped twice", tt.name)
+		}
+	}
+	if WrapError(nil, "containers", "", "", nil) != nil {
+		t.Error("a nil error wrapped")
+	}
+}
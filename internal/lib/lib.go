@@ -1,52 +1,94 @@
 package lib
 
 import (
+	"context"
+	"net"
 	"strconv"
 	"strings"
 	"time"
 
 	sdkArgs "github.com/newrelic/infra-integrations-sdk/args"
-	"github.com/newrelic/infra-integrations-sdk/data/metric"
-	"github.com/newrelic/infra-integrations-sdk/integration"
 )
 
 var IntegrationName = "com.newrelic.nri-docker"
-var IntegrationVersion = "testV1"
+var IntegrationVersion = "dev" // set at build time through -ldflags -X
 var Hostname = ""
 var SwarmState = "inactive"
+var Runtime = "docker" // docker or podman, set from the engine's version components
+var CgroupDriver = ""  // cgroupfs or systemd, set from /info
 
 type ArgumentList struct {
 	sdkArgs.DefaultArgumentList
-	Local      bool   `default:"true" help:"Collect local entity info (merges host metadata into event sample)"`
-	Exclude    string `default:"true" help:"Comma separated list to filter out unneeded metrics"`
-	APIVersion string `default:"" help:"Force integrations client API version"`
+	Local                bool   `default:"true" help:"Collect local entity info (merges host metadata into event sample)"`
+	Exclude              string `default:"true" help:"Comma separated list to filter out unneeded metrics"`
+	APIVersion           string `default:"" help:"Force integrations client API version"`
+	DockerHost           string `default:"" help:"Docker daemon to collect from eg. tcp://10.0.0.5:2376, defaults to the local socket"`
+	TLSCACert            string `default:"" help:"CA certificate used to verify the DockerHost daemon"`
+	TLSCert              string `default:"" help:"Client certificate presented to the DockerHost daemon"`
+	TLSKey               string `default:"" help:"Client key presented to the DockerHost daemon"`
+	TLSVerify            bool   `default:"true" help:"Verify the DockerHost daemon certificate"`
+	Endpoints            string `default:"" help:"JSON array of named engines, each with name, host, tlsCACert, tlsCert, tlsKey and tlsVerify"`
+	DiscoverSockets      bool   `default:"true" help:"Look for rootless and alternative Docker sockets when no engine is configured"`
+	HostRoot             string `default:"" help:"Where the host filesystem is mounted when running in a container eg. /host"`
+	HostFiles            bool   `default:"true" help:"Read /proc, cgroups, log files and daemon.json of local daemons below host_root, false when containers run in a VM"`
+	ContainerdSocket     string `default:"" help:"Also collect from this containerd socket eg. /run/containerd/containerd.sock"`
+	ContainerdNamespaces string `default:"" help:"Comma separated containerd namespaces to collect, defaults to all but moby"`
+	DockerContexts       string `default:"" help:"Comma separated docker CLI contexts to collect from, or all"`
+	Daemon               bool   `default:"false" help:"Keep running, streaming container stats and publishing every interval"`
+	Interval             int    `default:"15" help:"Seconds between publishes in daemon mode"`
+	Concurrency          int    `default:"10" help:"Maximum number of containers collected in parallel"`
+	APITimeout           int    `default:"10" help:"Seconds a single Docker API call may take, 0 disables"`
+	RunTimeout           int    `default:"60" help:"Seconds a whole collection run may take before partial results are published, 0 disables"`
+	ContainerInventory   bool   `default:"true" help:"Publish container and daemon configuration as inventory"`
+	SecurityChecks       bool   `default:"true" help:"Report dockerContainerSecuritySample and dockerDaemonComplianceSample with CIS Docker Benchmark style checks"`
+	DaemonPolicy         string `default:"" help:"JSON object of daemon setting to expected value merged over the default compliance policy, null drops a check"`
+	DaemonConfig         string `default:"/etc/docker/daemon.json" help:"Path of daemon.json, read below host_root, for settings /info does not report"`
+	ContainerLogsLabel   string `default:"" help:"Count log lines matching log_patterns for containers with this label, key or key=value, empty disables"`
+	LogPatterns          string `default:"" help:"JSON object of name to regular expression merged over the default error, exception and panic patterns, null drops one"`
+	LogLineLength        int    `default:"256" help:"Bytes of the last matching log line reported, 0 reports it whole"`
+	ContainerProcesses   bool   `default:"false" help:"Report dockerContainerProcessSample from docker top and process, thread and zombie counts per container"`
+	MaxProcesses         int    `default:"20" help:"Processes reported per container, the busiest first, 0 reports all"`
+	StatePath            string `default:"" help:"File values kept between runs are stored in, defaults to the integrations temp dir"`
+	GrowthWindow         int    `default:"3600" help:"Seconds of history growth rates and time to full are computed over"`
+	Redact               bool   `default:"true" help:"Redact secrets such as passwords, tokens and credentials in URLs from every reported string"`
+	RedactPatterns       string `default:"" help:"JSON array of extra regular expressions whose matches are redacted"`
+	Sinks                string `default:"sdk" help:"Comma separated outputs to publish to: sdk, jsonl, statsd, influx, otlp"`
+	JSONLinesPath        string `default:"" help:"File the jsonl sink appends samples to"`
+	StatsdAddress        string `default:"127.0.0.1:8125" help:"host:port the statsd sink sends to"`
+	InfluxURL            string `default:"" help:"InfluxDB write URL or file path the influx sink writes line protocol to"`
+	InfluxToken          string `default:"" help:"Optional token sent to the InfluxDB write API"`
+	OtlpEndpoint         string `default:"" help:"Also export samples as OpenTelemetry metrics to this OTLP endpoint"`
+	OtlpProtocol         string `default:"http/protobuf" help:"OTLP transport: http/protobuf, http/json or grpc"`
+	OtlpHeaders          string `default:"" help:"Comma separated key=value headers sent with OTLP exports"`
+	OtlpTimeout          int    `default:"10" help:"OTLP export timeout in seconds"`
 }
 
 var Args ArgumentList
 
 // SetMetric x
-func SetMetric(metricSet *metric.Set, key string, val interface{}) {
+func SetMetric(metricSet *Sample, key string, val interface{}) {
 	if checkExclusions(key, Args) == true {
-		switch val.(type) {
+		switch v := val.(type) {
 		case float64:
-			metricSet.SetMetric(key, val, metric.GAUGE)
+			metricSet.Metrics[key] = v
 		case uint16:
-			metricSet.SetMetric(key, val, metric.GAUGE)
+			metricSet.Metrics[key] = float64(v)
 		case uint32:
-			metricSet.SetMetric(key, val, metric.GAUGE)
+			metricSet.Metrics[key] = float64(v)
 		case uint64:
-			metricSet.SetMetric(key, val, metric.GAUGE)
+			metricSet.Metrics[key] = float64(v)
 		case int:
-			metricSet.SetMetric(key, val, metric.GAUGE)
+			metricSet.Metrics[key] = float64(v)
 		case int32:
-			metricSet.SetMetric(key, val, metric.GAUGE)
+			metricSet.Metrics[key] = float64(v)
 		case int64:
-			metricSet.SetMetric(key, val, metric.GAUGE)
+			metricSet.Metrics[key] = float64(v)
 		case bool:
-			metricSet.SetMetric(key, strconv.FormatBool(val.(bool)), metric.ATTRIBUTE)
+			metricSet.Metrics[key] = strconv.FormatBool(v)
 		case string:
-			if val.(string) != "" {
-				metricSet.SetMetric(key, val, metric.ATTRIBUTE)
+			// labels and NRDI_ variables under a secret name are redacted whole
+			if v != "" {
+				metricSet.Metrics[key] = Redact(RedactSetting(key, v))
 			}
 		}
 	}
@@ -64,9 +106,9 @@ func checkExclusions(key string, args ArgumentList) bool {
 	return passed
 }
 
-// NewMetricSet x
-func NewMetricSet(event string, entity *integration.Entity) *metric.Set {
-	metricSet := entity.NewMetricSet(event)
+// NewSample x
+func NewSample(event string, entity *Entity) *Sample {
+	metricSet := entity.NewSample(event)
 	SetMetric(metricSet, "integration_version", IntegrationVersion)
 	return metricSet
 }
@@ -77,24 +119,43 @@ func createKeyValuePairs(ds map[string]interface{}, m map[string]string) {
 	}
 }
 
-// ErrorLogToInsights x
-func ErrorLogToInsights(err error, entity *integration.Entity) {
-	errorMetricSet := entity.NewMetricSet("dockerIntegrationError")
-	errorMetricSet.SetMetric("errorMsg", err.Error(), metric.ATTRIBUTE)
-	errorMetricSet.SetMetric("hostname", Hostname, metric.ATTRIBUTE)
+// RunContext bounds a whole collection run by the run_timeout argument
+func RunContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if Args.RunTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, time.Duration(Args.RunTimeout)*time.Second)
+}
+
+// CallContext bounds a single Docker API call by the api_timeout argument
+func CallContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if Args.APITimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, time.Duration(Args.APITimeout)*time.Second)
 }
 
-func PanicOnErr(err error) {
-	if err != nil {
-		panic(err)
+// IsTimeout reports whether err comes from a deadline or cancelled context rather than from dockerd
+func IsTimeout(err error) bool {
+	if err == nil {
+		return false
+	}
+	if err == context.DeadlineExceeded || err == context.Canceled {
+		return true
+	}
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		return true
 	}
+	// the docker client wraps context errors without keeping them comparable
+	msg := err.Error()
+	return strings.Contains(msg, context.DeadlineExceeded.Error()) || strings.Contains(msg, context.Canceled.Error())
 }
 
 func MakeTimestamp() int64 {
 	return time.Now().UnixNano() / int64(time.Millisecond)
 }
 
-func ApplyLabel(label string, metricSet *metric.Set, customKey string) {
+func ApplyLabel(label string, metricSet *Sample, customKey string) {
 	labelSplit := strings.SplitN(label, "=", 2)
 	if len(labelSplit) == 2 {
 		if labelSplit[0] != "" && labelSplit[1] != "" {
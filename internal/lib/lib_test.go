@@ -0,0 +1,86 @@
+package lib
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	sdkArgs "github.com/newrelic/infra-integrations-sdk/args"
+)
+
+// SetupArgs panics when two fields, including those of the sdk's DefaultArgumentList, map to the same flag
+func TestSetupArgs(t *testing.T) {
+	args := ArgumentList{}
+	if err := sdkArgs.SetupArgs(&args); err != nil {
+		t.Fatal(err)
+	}
+	if !args.ContainerInventory || args.Inventory {
+		t.Errorf("container_inventory %v and inventory %v, want the defaults true and false", args.ContainerInventory, args.Inventory)
+	}
+	if !args.HasInventory() {
+		t.Error("inventory is published when no data flag is set")
+	}
+}
+
+func TestSetMetricRedaction(t *testing.T) {
+	defer func(exclude string) { Args.Exclude = exclude }(Args.Exclude)
+	Args.Exclude = "true"
+	tests := []struct {
+		label     string
+		customKey string
+		key       string
+		want      string
+	}{
+		{"db_password=hunter2", "", "db_password", RedactedValue},
+		{"NRDI_DB_PASSWORD=hunter2", "", "NRDI_DB_PASSWORD", RedactedValue},
+		{"NRDI_API_KEY=abc123", "", "NRDI_API_KEY", RedactedValue},
+		{"com.example.auth-token=0f1e2d3c", "", "com.example.auth-token", RedactedValue},
+		{"NRDI_DSN=postgres://app:s3cr3t@db:5432/orders", "", "NRDI_DSN", "postgres://app:[REDACTED]@db:5432/orders"},
+		{"NRDI_TEAM=payments", "", "NRDI_TEAM", "payments"},
+		{"NEW_RELIC_APP_NAME=checkout", "appName", "appName", "checkout"},
+		{"com.docker.compose.service=web", "", "com.docker.compose.service", "web"},
+	}
+	for _, tt := range tests {
+		sample := &Sample{Metrics: map[string]interface{}{}}
+		ApplyLabel(tt.label, sample, tt.customKey)
+		if got := sample.Metrics[tt.key]; got != tt.want {
+			t.Errorf("%s: %s = %v, want %q", tt.label, tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestCallAndRunContext(t *testing.T) {
+	defer func(api, run int) { Args.APITimeout, Args.RunTimeout = api, run }(Args.APITimeout, Args.RunTimeout)
+	soon, cancelSoon := context.WithTimeout(context.Background(), time.Second)
+	defer cancelSoon()
+	tests := []struct {
+		name    string
+		parent  context.Context
+		timeout int
+		// want is the deadline relative to now, 0 for none
+		want time.Duration
+	}{
+		{"a timeout", context.Background(), 10, 10 * time.Second},
+		{"no timeout", context.Background(), 0, 0},
+		{"a negative timeout", context.Background(), -1, 0},
+		// the run deadline bounds every call made within it
+		{"an earlier parent deadline", soon, 10, time.Second},
+		{"a parent deadline and no timeout", soon, 0, time.Second},
+	}
+	for _, tt := range tests {
+		for name, bound := range map[string]func(context.Context) (context.Context, context.CancelFunc){"CallContext": CallContext, "RunContext": RunContext} {
+			Args.APITimeout, Args.RunTimeout = tt.timeout, tt.timeout
+			ctx, cancel := bound(tt.parent)
+			deadline, ok := ctx.Deadline()
+			if ok != (tt.want != 0) {
+				t.Errorf("%s %s: deadline %v", name, tt.name, ok)
+			} else if left := time.Until(deadline); ok && (left > tt.want || left < tt.want-time.Second/2) {
+				t.Errorf("%s %s: deadline in %v, want %v", name, tt.name, left, tt.want)
+			}
+			cancel()
+			if ctx.Err() != context.Canceled {
+				t.Errorf("%s %s: cancel left %v", name, tt.name, ctx.Err())
+			}
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// RedactedValue replaces every detected secret
+const RedactedValue = "[REDACTED]"
+
+// secretKeys matches setting names whose whole value is a secret, eg. splunk-token or awslogs-credentials
+var secretKeys = regexp.MustCompile(`(?i)(password|passwd|token|secret|credential|auth|key)`)
+
+// detector finds one kind of secret, replacement may keep parts of the match through $1 style groups
+type detector struct {
+	name        string
+	pattern     *regexp.Regexp
+	replacement string
+}
+
+// built in detectors, applied in order so a value is only counted once
+var builtinDetectors = []detector{
+	{
+		// PASSWORD=x, DB_TOKEN: x, --api-key=x, aws_secret_access_key=x
+		name:        "keyValue",
+		pattern:     regexp.MustCompile(`(?i)([\w.-]*(?:password|passwd|token|secret|api[_-]?key|access[_-]?key|credentials?)[\w.-]*(?:\s*=\s*|\s*:\s+))("[^"]*"|'[^']*'|[^\s,;&]+)`),
+		replacement: "${1}" + RedactedValue,
+	},
+	{
+		name:        "urlCredentials",
+		pattern:     regexp.MustCompile(`([a-zA-Z][a-zA-Z0-9+.-]*://[^:/@\s]*:)[^@/\s]+@`),
+		replacement: "${1}" + RedactedValue + "@",
+	},
+	{
+		name:        "jwt",
+		pattern:     regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`),
+		replacement: RedactedValue,
+	},
+	{
+		name:        "awsAccessKey",
+		pattern:     regexp.MustCompile(`\b(?:AKIA|ASIA|AGPA|AIDA|AROA|ANPA|ANVA)[0-9A-Z]{16}\b`),
+		replacement: RedactedValue,
+	},
+}
+
+// Redactor removes secrets from strings and counts what it removed by detector
+type Redactor struct {
+	detectors []detector
+	keys      *regexp.Regexp
+	lock      sync.Mutex
+	counts    map[string]int
+}
+
+// redactor is used by SetMetric, ConfigureRedaction adds the configured patterns
+var redactor = NewRedactor(nil)
+
+// NewRedactor creates a redactor with the built in detectors followed by extra patterns
+func NewRedactor(extra []*regexp.Regexp) *Redactor {
+	r := &Redactor{detectors: append([]detector{}, builtinDetectors...), keys: secretKeys, counts: map[string]int{}}
+	for i, pattern := range extra {
+		r.detectors = append(r.detectors, detector{name: fmt.Sprintf("custom%d", i), pattern: pattern, replacement: RedactedValue})
+	}
+	return r
+}
+
+// ConfigureRedaction compiles patterns, a JSON array of regular expressions, and
+// applies them together with the built in detectors. Disabled turns redaction off.
+func ConfigureRedaction(enabled bool, patterns string) error {
+	if !enabled {
+		redactor = &Redactor{counts: map[string]int{}}
+		return nil
+	}
+	extra := []*regexp.Regexp{}
+	if strings.TrimSpace(patterns) != "" {
+		sources := []string{}
+		if err := json.Unmarshal([]byte(patterns), &sources); err != nil {
+			return fmt.Errorf("cannot parse redact patterns: %v", err)
+		}
+		for _, source := range sources {
+			pattern, err := regexp.Compile(source)
+			if err != nil {
+				return fmt.Errorf("cannot compile redact pattern %q: %v", source, err)
+			}
+			extra = append(extra, pattern)
+		}
+	}
+	redactor = NewRedactor(extra)
+	return nil
+}
+
+// Redact returns val with every detected secret replaced
+func Redact(val string) string {
+	return redactor.Redact(val)
+}
+
+// Redact returns val with every detected secret replaced
+func (r *Redactor) Redact(val string) string {
+	for _, d := range r.detectors {
+		matches := 0
+		val = d.pattern.ReplaceAllStringFunc(val, func(match string) string {
+			redacted := d.pattern.ReplaceAllString(match, d.replacement)
+			// a value redacted before, eg. PASSWORD=[REDACTED], is not counted again
+			if redacted != match {
+				matches++
+			}
+			return redacted
+		})
+		if matches == 0 {
+			continue
+		}
+		r.lock.Lock()
+		r.counts[d.name] += matches
+		r.lock.Unlock()
+	}
+	return val
+}
+
+// RedactSetting returns the value of the setting key redacted whole when key names a secret, other
+// values are left to the redaction SetMetric and SetInventoryItem apply
+func RedactSetting(key, val string) string {
+	return redactor.RedactSetting(key, val)
+}
+
+// RedactSetting returns the value of the setting key, redacted whole when key names a secret
+func (r *Redactor) RedactSetting(key, val string) string {
+	if r.keys != nil && val != "" && r.keys.MatchString(key) {
+		r.lock.Lock()
+		r.counts["secretSetting"]++
+		r.lock.Unlock()
+		return RedactedValue
+	}
+	return val
+}
+
+// takeCounts returns the redactions made since the last call and resets them
+func (r *Redactor) takeCounts() map[string]int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	counts := r.counts
+	r.counts = map[string]int{}
+	return counts
+}
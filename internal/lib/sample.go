@@ -0,0 +1,152 @@
+package lib
+
+import (
+	"sync"
+	"time"
+)
+
+// Payload holds every entity and sample gathered during one collection run,
+// independent of where the data is eventually published
+type Payload struct {
+	Entities []*Entity
+	// Attributes are added to every sample of the entities created through this payload
+	Attributes map[string]string
+	lock       sync.Mutex
+}
+
+// Entity is the producer of samples, either the local host (empty Name) or a named object such as a container
+type Entity struct {
+	Name      string
+	Namespace string
+	Samples   []*Sample
+	// Inventory holds configuration items, key to field to value
+	Inventory  map[string]map[string]interface{}
+	Events     []Event
+	attributes map[string]string
+	lock       sync.Mutex
+}
+
+// Event is a notable occurrence such as a daemon warning, published as an infra event
+type Event struct {
+	Summary  string
+	Category string
+}
+
+// Sample is one event, Metrics holds float64 gauges and string attributes
+type Sample struct {
+	Event     string
+	Timestamp time.Time
+	Metrics   map[string]interface{}
+}
+
+// NewPayload creates an empty payload
+func NewPayload() *Payload {
+	return &Payload{Entities: []*Entity{}, Attributes: map[string]string{}}
+}
+
+// LocalEntity retrieves or creates the entity representing the monitored host
+func (p *Payload) LocalEntity() *Entity {
+	return p.Entity("", "")
+}
+
+// Entity retrieves or creates the entity identified by name and namespace
+func (p *Payload) Entity(name, namespace string) *Entity {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for _, e := range p.Entities {
+		if e.Name == name && e.Namespace == namespace {
+			return e
+		}
+	}
+	e := &Entity{Name: name, Namespace: namespace, Samples: []*Sample{}, Inventory: map[string]map[string]interface{}{}, attributes: p.Attributes}
+	p.Entities = append(p.Entities, e)
+	return e
+}
+
+// Merge moves the entities of other into p, samples of entities present in both are combined
+func (p *Payload) Merge(other *Payload) {
+	for _, o := range other.Entities {
+		e := p.Entity(o.Name, o.Namespace)
+		e.lock.Lock()
+		e.Samples = append(e.Samples, o.Samples...)
+		e.Events = append(e.Events, o.Events...)
+		for key, fields := range o.Inventory {
+			if e.Inventory[key] == nil {
+				e.Inventory[key] = map[string]interface{}{}
+			}
+			for field, val := range fields {
+				e.Inventory[key][field] = val
+			}
+		}
+		e.lock.Unlock()
+	}
+}
+
+// IsLocal is true for the host entity
+func (e *Entity) IsLocal() bool {
+	return e.Name == ""
+}
+
+// NewSample attaches a new empty sample to the entity
+func (e *Entity) NewSample(event string) *Sample {
+	s := &Sample{
+		Event:     event,
+		Timestamp: time.Now(),
+		Metrics:   map[string]interface{}{},
+	}
+	for key, val := range e.attributes {
+		s.Metrics[key] = val
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.Samples = append(e.Samples, s)
+	return s
+}
+
+// SetInventoryItem records one configuration value, strings are redacted and empty ones dropped like in SetMetric
+func (e *Entity) SetInventoryItem(key, field string, val interface{}) {
+	if str, ok := val.(string); ok {
+		if str == "" {
+			return
+		}
+		val = Redact(str)
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if e.Inventory[key] == nil {
+		e.Inventory[key] = map[string]interface{}{}
+	}
+	e.Inventory[key][field] = val
+}
+
+// AddEvent records an event, the summary is redacted like every other string
+func (e *Entity) AddEvent(summary, category string) {
+	if summary == "" {
+		return
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.Events = append(e.Events, Event{Summary: Redact(summary), Category: category})
+}
+
+// Attributes returns the string attributes of the sample
+func (s *Sample) Attributes() map[string]string {
+	attributes := map[string]string{}
+	for key, val := range s.Metrics {
+		if str, ok := val.(string); ok {
+			attributes[key] = str
+		}
+	}
+	return attributes
+}
+
+// Gauges returns the numeric metrics of the sample
+func (s *Sample) Gauges() map[string]float64 {
+	gauges := map[string]float64{}
+	for key, val := range s.Metrics {
+		if num, ok := val.(float64); ok {
+			gauges[key] = num
+		}
+	}
+	return gauges
+}
@@ -0,0 +1,183 @@
+package lib
+
+import (
+	"sync"
+	"time"
+
+	"github.com/newrelic/infra-integrations-sdk/log"
+	"github.com/newrelic/infra-integrations-sdk/persist"
+)
+
+// stateTTL is how old the state file may be, after a longer gap rates start over
+const stateTTL = 24 * time.Hour
+
+// keys the growth series and checkpoints are kept under in the state file
+const (
+	seriesKey      = "series"
+	checkpointsKey = "checkpoints"
+	countersKey    = "counters"
+)
+
+// counter is a monotonic value that restarts from zero, eg. with a container's cgroup,
+// and the total of its increases over restarts
+type counter struct {
+	Time  int64
+	Last  float64
+	Total float64
+}
+
+// reading is one value of a growth series
+type reading struct {
+	Time  int64
+	Value float64
+}
+
+var (
+	// state keeps values between runs, it lives in memory until OpenState loads it from disk
+	state       = persist.NewInMemoryStore()
+	series      = map[string][]reading{}
+	checkpoints = map[string]int64{}
+	counters    = map[string]*counter{}
+	stateLock   sync.Mutex
+)
+
+// OpenState loads the state kept between runs from path, or from the default
+// integrations storage path when empty
+func OpenState(path string) error {
+	if path == "" {
+		path = persist.DefaultPath(IntegrationName + "-state")
+	}
+	store, err := persist.NewFileStore(path, log.NewStdErr(Args.Verbose), stateTTL)
+	if err != nil {
+		return err
+	}
+	loaded, loadedCheckpoints, loadedCounters := map[string][]reading{}, map[string]int64{}, map[string]*counter{}
+	if _, err := store.Get(seriesKey, &loaded); err != nil && err != persist.ErrNotFound {
+		log.Warn("cannot read state %s: %v", path, err)
+	}
+	if _, err := store.Get(checkpointsKey, &loadedCheckpoints); err != nil && err != persist.ErrNotFound {
+		log.Warn("cannot read state %s: %v", path, err)
+	}
+	if _, err := store.Get(countersKey, &loadedCounters); err != nil && err != persist.ErrNotFound {
+		log.Warn("cannot read state %s: %v", path, err)
+	}
+
+	stateLock.Lock()
+	defer stateLock.Unlock()
+	state, series, checkpoints, counters = store, loaded, loadedCheckpoints, loadedCounters
+	return nil
+}
+
+// SaveState drops series without a reading in the growth window and checkpoints and
+// counters older than the state itself, and persists the rest
+func SaveState() error {
+	stateLock.Lock()
+	now := time.Now()
+	for key, checkpoint := range checkpoints {
+		if checkpoint < now.Add(-stateTTL).UnixNano() {
+			delete(checkpoints, key)
+		}
+	}
+	state.Set(checkpointsKey, checkpoints)
+	for key, c := range counters {
+		if c.Time < now.Add(-stateTTL).Unix() {
+			delete(counters, key)
+		}
+	}
+	state.Set(countersKey, counters)
+	cutoff := now.Unix() - int64(Args.GrowthWindow)
+	kept := map[string][]reading{}
+	for key, readings := range series {
+		if len(readings) > 0 && readings[len(readings)-1].Time >= cutoff {
+			kept[key] = readings
+		}
+	}
+	series = kept
+	state.Set(seriesKey, kept)
+	stateLock.Unlock()
+	return state.Save()
+}
+
+// GrowthRate adds value to the series stored under key and returns how much it grew per
+// second over the growth window, ok is false until a previous reading exists
+func GrowthRate(key string, value float64) (float64, bool) {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+	now := time.Now().Unix()
+	cutoff := now - int64(Args.GrowthWindow)
+
+	readings := []reading{}
+	for _, r := range series[key] {
+		if r.Time >= cutoff && r.Time < now {
+			readings = append(readings, r)
+		}
+	}
+	readings = append(readings, reading{Time: now, Value: value})
+	series[key] = readings
+
+	oldest := readings[0]
+	if oldest.Time == now {
+		return 0, false
+	}
+	return (value - oldest.Value) / float64(now-oldest.Time), true
+}
+
+// Checkpoint stores now, in unix nanoseconds, under key and returns the previously stored one
+func Checkpoint(key string, now int64) (int64, bool) {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+	previous, ok := checkpoints[key]
+	checkpoints[key] = now
+	return previous, ok
+}
+
+// Rate stores value under key and returns its change per second since the previous
+// run, ok is false on the first reading and when the counter was reset
+func Rate(key string, value float64) (float64, bool) {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+	now := time.Now().Unix()
+	previous := series[key]
+	series[key] = []reading{{Time: now, Value: value}}
+	if len(previous) == 0 {
+		return 0, false
+	}
+	last := previous[len(previous)-1]
+	if last.Time >= now || value < last.Value {
+		return 0, false
+	}
+	return (value - last.Value) / float64(now-last.Time), true
+}
+
+// Increase stores the counter value under key and returns how much it grew since the
+// previous run. The first value seen is the baseline and counts as no increase, after the
+// counter restarted from zero the whole value is new.
+func Increase(key string, value float64) float64 {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+	c, seen := counters[key]
+	if !seen {
+		counters[key] = &counter{Time: time.Now().Unix(), Last: value}
+		return 0
+	}
+	increase := value
+	if value >= c.Last {
+		increase = value - c.Last
+	}
+	c.Time, c.Last = time.Now().Unix(), value
+	return increase
+}
+
+// Accumulate adds increase to the total kept under key and returns the total
+func Accumulate(key string, increase float64) float64 {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+	c, ok := counters[key]
+	if !ok {
+		c = &counter{}
+		counters[key] = c
+	}
+	c.Time = time.Now().Unix()
+	c.Total += increase
+	return c.Total
+}
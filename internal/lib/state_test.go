@@ -0,0 +1,54 @@
+package lib
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestIncrease(t *testing.T) {
+	counters = map[string]*counter{}
+	steps := []struct {
+		value float64
+		want  float64
+	}{
+		// the first value is history, not new
+		{5, 0},
+		{5, 0},
+		{7, 2},
+		// restarted from zero, eg. with a new cgroup
+		{1, 1},
+		{3, 2},
+	}
+	for i, step := range steps {
+		if got := Increase("oom", step.value); got != step.want {
+			t.Errorf("step %d: increase to %v is %v, want %v", i, step.value, got, step.want)
+		}
+	}
+	if total := Accumulate("total", 2) + Accumulate("total", 3); total != 2+5 {
+		t.Errorf("accumulated %v", total)
+	}
+}
+
+func TestStatePersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state")
+	if err := OpenState(path); err != nil {
+		t.Fatal(err)
+	}
+	Increase("oom/web/cgroup", 4)
+	Checkpoint("logs/web", 1600000000000000000)
+	if err := SaveState(); err != nil {
+		t.Fatal(err)
+	}
+
+	counters, checkpoints = map[string]*counter{}, map[string]int64{}
+	if err := OpenState(path); err != nil {
+		t.Fatal(err)
+	}
+	if got := Increase("oom/web/cgroup", 6); got != 2 {
+		t.Errorf("increase after reopening is %v, want 2", got)
+	}
+	// saved checkpoints older than the state's ttl are dropped
+	if _, ok := Checkpoint("logs/web", 1); ok {
+		t.Error("a day old checkpoint survived")
+	}
+}
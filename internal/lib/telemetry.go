@@ -0,0 +1,186 @@
+package lib
+
+import (
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Self gathers telemetry about the integration itself during a run, it is
+// reported as dockerIntegrationSelfSample
+var Self = NewTelemetry()
+
+// Telemetry records run and collector durations, Docker API call latencies and counters
+type Telemetry struct {
+	lock       sync.Mutex
+	start      time.Time
+	collectors map[string]time.Duration
+	calls      map[string][]time.Duration
+	callErrors map[string]int
+	errors     map[ErrorKind]int
+	counters   map[string]float64
+}
+
+// NewTelemetry creates an empty recorder
+func NewTelemetry() *Telemetry {
+	t := &Telemetry{}
+	t.Reset()
+	return t
+}
+
+// Reset starts a new run
+func (t *Telemetry) Reset() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.start = time.Now()
+	t.collectors = map[string]time.Duration{}
+	t.calls = map[string][]time.Duration{}
+	t.callErrors = map[string]int{}
+	t.errors = map[ErrorKind]int{}
+	t.counters = map[string]float64{}
+	redactor.takeCounts()
+}
+
+// TimeCollector runs fn and records how long it took under name
+func (t *Telemetry) TimeCollector(name string, fn func()) {
+	start := time.Now()
+	fn()
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.collectors[name] += time.Since(start)
+}
+
+// ObserveCall records the latency of one Docker API call
+func (t *Telemetry) ObserveCall(endpoint string, d time.Duration, failed bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.calls[endpoint] = append(t.calls[endpoint], d)
+	if failed {
+		t.callErrors[endpoint]++
+	}
+}
+
+// CountError records a reported error by kind
+func (t *Telemetry) CountError(kind ErrorKind) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.errors[kind]++
+}
+
+// Add increments a free form counter such as containersSeen
+func (t *Telemetry) Add(key string, delta float64) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.counters[key] += delta
+}
+
+// Publish writes the dockerIntegrationSelfSample for the run so far
+func (t *Telemetry) Publish(entity *Entity, apiVersion string, payloadBytes int) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	metricSet := NewSample("dockerIntegrationSelfSample", entity)
+	SetMetric(metricSet, "hostname", Hostname)
+	SetMetric(metricSet, "apiVersion", apiVersion)
+	SetMetric(metricSet, "payloadBytes", payloadBytes)
+	SetMetric(metricSet, "runDurationMs", milliseconds(time.Since(t.start)))
+
+	for name, d := range t.collectors {
+		SetMetric(metricSet, "collector."+name+".durationMs", milliseconds(d))
+	}
+
+	totalCalls, totalErrors := 0, 0
+	for endpoint, latencies := range t.calls {
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		key := "api." + endpointKey(endpoint)
+		SetMetric(metricSet, key+".calls", len(latencies))
+		SetMetric(metricSet, key+".errors", t.callErrors[endpoint])
+		SetMetric(metricSet, key+".p50Ms", milliseconds(percentile(latencies, 0.50)))
+		SetMetric(metricSet, key+".p90Ms", milliseconds(percentile(latencies, 0.90)))
+		SetMetric(metricSet, key+".p99Ms", milliseconds(percentile(latencies, 0.99)))
+		SetMetric(metricSet, key+".maxMs", milliseconds(latencies[len(latencies)-1]))
+		totalCalls += len(latencies)
+		totalErrors += t.callErrors[endpoint]
+	}
+	SetMetric(metricSet, "apiCalls", totalCalls)
+	SetMetric(metricSet, "apiCallErrors", totalErrors)
+
+	errorTotal := 0
+	for kind, count := range t.errors {
+		SetMetric(metricSet, "errors."+string(kind), count)
+		errorTotal += count
+	}
+	SetMetric(metricSet, "errors", errorTotal)
+
+	for key, val := range t.counters {
+		SetMetric(metricSet, key, val)
+	}
+
+	redactionTotal := 0
+	for name, count := range redactor.takeCounts() {
+		SetMetric(metricSet, "redactions."+name, count)
+		redactionTotal += count
+	}
+	SetMetric(metricSet, "redactions", redactionTotal)
+}
+
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	return sorted[int(float64(len(sorted)-1)*p+0.5)]
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// the docker API's /v1.40 and libpod's /v4.0.0 version prefixes
+var apiVersionPrefix = regexp.MustCompile(`^/v[0-9]+(\.[0-9]+)+(/|$)`)
+
+// objects whose second path segment is an ID or name rather than an action
+var apiObjects = map[string]bool{
+	"containers": true, "services": true, "nodes": true, "tasks": true, "networks": true,
+	"volumes": true, "images": true, "exec": true, "plugins": true, "secrets": true, "configs": true, "pods": true,
+}
+
+var apiActions = map[string]bool{"json": true, "create": true, "prune": true, "stats": true}
+
+// EndpointOf normalises a request path such as /v1.40/containers/<id>/stats into /containers/{id}/stats
+func EndpointOf(path string) string {
+	path = apiVersionPrefix.ReplaceAllString(path, "/")
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for i := 1; i < len(segments); i++ {
+		if apiObjects[segments[i-1]] && !apiActions[segments[i]] {
+			segments[i] = "{id}"
+		}
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
+// endpointKey turns /containers/{id}/stats into containers.id.stats for use in metric names
+func endpointKey(endpoint string) string {
+	key := strings.Trim(endpoint, "/")
+	key = strings.NewReplacer("{", "", "}", "", "/", ".").Replace(key)
+	if key == "" {
+		return "root"
+	}
+	return key
+}
+
+// InstrumentedTransport records every request made through it in Self
+type InstrumentedTransport struct {
+	Base http.RoundTripper
+}
+
+// RoundTrip times the request up to the response headers, which for streams is the time to first byte
+func (t *InstrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.Base.RoundTrip(req)
+	failed := err != nil || resp.StatusCode >= 400
+	Self.ObserveCall(EndpointOf(req.URL.Path), time.Since(start), failed)
+	return resp, err
+}
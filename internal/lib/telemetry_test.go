@@ -0,0 +1,30 @@
+package lib
+
+import "testing"
+
+func TestEndpointOf(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+		key  string
+	}{
+		{"/v1.40/containers/3f4e8a1b2c/stats", "/containers/{id}/stats", "containers.id.stats"},
+		{"/v1.24/containers/json", "/containers/json", "containers.json"},
+		{"/containers/web/json", "/containers/{id}/json", "containers.id.json"},
+		{"/v1.41/info", "/info", "info"},
+		{"/_ping", "/_ping", "_ping"},
+		{"/v4.0.0/libpod/pods/json", "/libpod/pods/json", "libpod.pods.json"},
+		{"/v1.40", "/", "root"},
+		{"/v1.40/networks/bridge", "/networks/{id}", "networks.id"},
+		{"/", "/", "root"},
+	}
+	for _, tt := range tests {
+		got := EndpointOf(tt.path)
+		if got != tt.want {
+			t.Errorf("EndpointOf(%q) is %q, want %q", tt.path, got, tt.want)
+		}
+		if key := endpointKey(got); key != tt.key {
+			t.Errorf("endpointKey(%q) is %q, want %q", got, key, tt.key)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/http2"
+)
+
+// Client performs unary gRPC calls over HTTP/2, either cleartext (h2c) or TLS.
+type Client struct {
+	baseURL string
+	http    *http.Client
+}
+
+// NewClient creates a gRPC client for target, which is either host:port or a
+// http:// or https:// URL. Plain host:port and http:// targets use cleartext HTTP/2.
+func NewClient(target string) *Client {
+	transport := &http2.Transport{}
+	baseURL := strings.TrimSuffix(target, "/")
+	switch {
+	case strings.HasPrefix(baseURL, "https://"):
+	case strings.HasPrefix(baseURL, "http://"):
+		transport.AllowHTTP = true
+		transport.DialTLS = dialCleartext
+	default:
+		baseURL = "http://" + baseURL
+		transport.AllowHTTP = true
+		transport.DialTLS = dialCleartext
+	}
+	return &Client{baseURL: baseURL, http: &http.Client{Transport: transport}}
+}
+
+// NewDialerClient creates a cleartext gRPC client that reaches its server
+// through dial, for servers listening on a unix socket.
+func NewDialerClient(dial func(network, addr string) (net.Conn, error)) *Client {
+	transport := &http2.Transport{
+		AllowHTTP: true,
+		DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+			return dial(network, addr)
+		},
+	}
+	return &Client{baseURL: "http://localhost", http: &http.Client{Transport: transport}}
+}
+
+func dialCleartext(network, addr string, cfg *tls.Config) (net.Conn, error) {
+	return net.Dial(network, addr)
+}
+
+// Invoke calls method (eg. /package.Service/Method) with an encoded request
+// message and returns the encoded response message.
+func (c *Client) Invoke(ctx context.Context, method string, request []byte, metadata map[string]string) ([]byte, error) {
+	frame := make([]byte, 5+len(request))
+	binary.BigEndian.PutUint32(frame[1:5], uint32(len(request)))
+	copy(frame[5:], request)
+
+	req, err := http.NewRequest(http.MethodPost, c.baseURL+method, bytes.NewReader(frame))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("content-type", "application/grpc")
+	req.Header.Set("te", "trailers")
+	for key, val := range metadata {
+		req.Header.Set(key, val)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("grpc %s: http status %d", method, resp.StatusCode)
+	}
+
+	// trailers-only responses carry the status in the headers
+	status := resp.Trailer.Get("grpc-status")
+	message := resp.Trailer.Get("grpc-message")
+	if status == "" {
+		status = resp.Header.Get("grpc-status")
+		message = resp.Header.Get("grpc-message")
+	}
+	if status != "" && status != "0" {
+		return nil, fmt.Errorf("grpc %s: status %s: %s", method, status, message)
+	}
+
+	if len(body) < 5 {
+		return []byte{}, nil
+	}
+	size := binary.BigEndian.Uint32(body[1:5])
+	if body[0] != 0 {
+		return nil, fmt.Errorf("grpc %s: compressed responses are not supported", method)
+	}
+	if int(size) > len(body)-5 {
+		return nil, fmt.Errorf("grpc %s: truncated response", method)
+	}
+	return body[5 : 5+size], nil
+}
@@ -0,0 +1,101 @@
+package rpc
+
+import (
+	"context"
+	"encoding/binary"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// grpcServer is a cleartext HTTP/2 stand-in answering every call with handle
+func grpcServer(t *testing.T, handle func(w http.ResponseWriter, r *http.Request, request []byte)) *httptest.Server {
+	server := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.ProtoMajor != 2 || r.Header.Get("content-type") != "application/grpc" || len(body) < 5 {
+			http.Error(w, "not a grpc request", http.StatusBadRequest)
+			return
+		}
+		handle(w, r, body[5:5+binary.BigEndian.Uint32(body[1:5])])
+	}), &http2.Server{}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func writeMessage(w http.ResponseWriter, message []byte) {
+	w.Header().Set("content-type", "application/grpc")
+	frame := make([]byte, 5+len(message))
+	binary.BigEndian.PutUint32(frame[1:5], uint32(len(message)))
+	copy(frame[5:], message)
+	w.Write(frame)
+}
+
+func TestInvoke(t *testing.T) {
+	server := grpcServer(t, func(w http.ResponseWriter, r *http.Request, request []byte) {
+		m, err := Parse(request)
+		if err != nil || r.URL.Path != "/test.Echo/Say" || r.Header.Get("x-tenant") != "a" {
+			w.Header().Set("grpc-status", "3")
+			return
+		}
+		response := &Buffer{}
+		response.String(1, "echo "+m.String(1))
+		writeMessage(w, response.Bytes())
+		w.Header().Set(http.TrailerPrefix+"grpc-status", "0")
+	})
+
+	for _, target := range []string{server.URL, strings.TrimPrefix(server.URL, "http://")} {
+		request := &Buffer{}
+		request.String(1, "hello")
+		response, err := NewClient(target).Invoke(context.Background(), "/test.Echo/Say", request.Bytes(), map[string]string{"x-tenant": "a"})
+		if err != nil {
+			t.Fatalf("%s: %v", target, err)
+		}
+		m, err := Parse(response)
+		if err != nil || m.String(1) != "echo hello" {
+			t.Errorf("%s: response %v, %v", target, m, err)
+		}
+	}
+}
+
+func TestInvokeStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		handle func(w http.ResponseWriter)
+		want   string
+	}{
+		{"trailers only", func(w http.ResponseWriter) {
+			w.Header().Set("content-type", "application/grpc")
+			w.Header().Set("grpc-status", "12")
+			w.Header().Set("grpc-message", "unimplemented")
+		}, "status 12: unimplemented"},
+		{"trailer", func(w http.ResponseWriter) {
+			writeMessage(w, nil)
+			w.Header().Set(http.TrailerPrefix+"grpc-status", "14")
+			w.Header().Set(http.TrailerPrefix+"grpc-message", "unavailable")
+		}, "status 14: unavailable"},
+		{"http status", func(w http.ResponseWriter) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}, "http status 503"},
+		{"compressed", func(w http.ResponseWriter) {
+			w.Header().Set("content-type", "application/grpc")
+			w.Write([]byte{1, 0, 0, 0, 1, 0})
+		}, "compressed"},
+		{"truncated", func(w http.ResponseWriter) {
+			w.Header().Set("content-type", "application/grpc")
+			w.Write([]byte{0, 0, 0, 0, 9, 0})
+		}, "truncated"},
+	}
+	for _, tt := range tests {
+		handle := tt.handle
+		server := grpcServer(t, func(w http.ResponseWriter, r *http.Request, request []byte) { handle(w) })
+		_, err := NewClient(server.URL).Invoke(context.Background(), "/test.Echo/Say", []byte{}, nil)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
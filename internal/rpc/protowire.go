@@ -0,0 +1,213 @@
+package rpc
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// protocol buffers wire types
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// Buffer is a minimal protocol buffers encoder, enough to build the handful of
+// messages this integration sends without pulling in generated code.
+// Parse is its decoding counterpart.
+type Buffer struct {
+	b []byte
+}
+
+// Bytes returns the encoded message
+func (e *Buffer) Bytes() []byte {
+	return e.b
+}
+
+func (e *Buffer) varint(v uint64) {
+	for v >= 0x80 {
+		e.b = append(e.b, byte(v)|0x80)
+		v >>= 7
+	}
+	e.b = append(e.b, byte(v))
+}
+
+func (e *Buffer) tag(field int, wireType int) {
+	e.varint(uint64(field)<<3 | uint64(wireType))
+}
+
+func (e *Buffer) fixed64(v uint64) {
+	for i := 0; i < 8; i++ {
+		e.b = append(e.b, byte(v>>(8*uint(i))))
+	}
+}
+
+// Varint writes an unsigned varint field, omitted when zero as proto3 does
+func (e *Buffer) Varint(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	e.tag(field, wireVarint)
+	e.varint(v)
+}
+
+// Bool writes a bool field, omitted when false
+func (e *Buffer) Bool(field int, v bool) {
+	if v {
+		e.Varint(field, 1)
+	}
+}
+
+// Fixed64 writes a fixed64 field, omitted when zero
+func (e *Buffer) Fixed64(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	e.tag(field, wireFixed64)
+	e.fixed64(v)
+}
+
+// Double writes a double field. It is always written so oneof members holding
+// a zero value survive the round trip.
+func (e *Buffer) Double(field int, v float64) {
+	e.tag(field, wireFixed64)
+	e.fixed64(math.Float64bits(v))
+}
+
+// String writes a string field, omitted when empty
+func (e *Buffer) String(field int, s string) {
+	if s == "" {
+		return
+	}
+	e.tag(field, wireBytes)
+	e.varint(uint64(len(s)))
+	e.b = append(e.b, s...)
+}
+
+// Message writes a length delimited embedded message built by fn
+func (e *Buffer) Message(field int, fn func(*Buffer)) {
+	nested := &Buffer{}
+	fn(nested)
+	e.tag(field, wireBytes)
+	e.varint(uint64(len(nested.b)))
+	e.b = append(e.b, nested.b...)
+}
+
+// Field is one decoded field, Varint holds varint and fixed64 values, Bytes length delimited ones
+type Field struct {
+	Number int
+	Wire   int
+	Varint uint64
+	Bytes  []byte
+}
+
+// Message is a decoded protocol buffers message, fields are looked up by number
+// as there is no generated code describing them
+type Message []Field
+
+// Parse decodes the fields of one message without descending into embedded ones
+func Parse(b []byte) (Message, error) {
+	m := Message{}
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, fmt.Errorf("protobuf: bad field key")
+		}
+		b = b[n:]
+		f := Field{Number: int(key >> 3), Wire: int(key & 7)}
+		switch f.Wire {
+		case wireVarint:
+			f.Varint, n = binary.Uvarint(b)
+			if n <= 0 {
+				return nil, fmt.Errorf("protobuf: bad varint in field %d", f.Number)
+			}
+			b = b[n:]
+		case wireFixed64:
+			if len(b) < 8 {
+				return nil, fmt.Errorf("protobuf: truncated fixed64 in field %d", f.Number)
+			}
+			f.Varint = binary.LittleEndian.Uint64(b)
+			b = b[8:]
+		case wireBytes:
+			size, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < size {
+				return nil, fmt.Errorf("protobuf: truncated bytes in field %d", f.Number)
+			}
+			f.Bytes = b[n : n+int(size)]
+			b = b[n+int(size):]
+		case wireFixed32:
+			if len(b) < 4 {
+				return nil, fmt.Errorf("protobuf: truncated fixed32 in field %d", f.Number)
+			}
+			f.Varint = uint64(binary.LittleEndian.Uint32(b))
+			b = b[4:]
+		default:
+			return nil, fmt.Errorf("protobuf: unsupported wire type %d in field %d", f.Wire, f.Number)
+		}
+		m = append(m, f)
+	}
+	return m, nil
+}
+
+// Uint returns the last value of a varint or fixed field, zero when absent
+func (m Message) Uint(field int) uint64 {
+	var v uint64
+	for _, f := range m {
+		if f.Number == field && f.Wire != wireBytes {
+			v = f.Varint
+		}
+	}
+	return v
+}
+
+// String returns the last value of a string field, empty when absent
+func (m Message) String(field int) string {
+	s := ""
+	for _, f := range m {
+		if f.Number == field && f.Wire == wireBytes {
+			s = string(f.Bytes)
+		}
+	}
+	return s
+}
+
+// Message returns the last embedded message of a field, empty when absent
+func (m Message) Message(field int) (Message, error) {
+	var b []byte
+	for _, f := range m {
+		if f.Number == field && f.Wire == wireBytes {
+			b = f.Bytes
+		}
+	}
+	return Parse(b)
+}
+
+// Messages returns every embedded message of a repeated field
+func (m Message) Messages(field int) ([]Message, error) {
+	messages := []Message{}
+	for _, f := range m {
+		if f.Number == field && f.Wire == wireBytes {
+			nested, err := Parse(f.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			messages = append(messages, nested)
+		}
+	}
+	return messages, nil
+}
+
+// Map returns a map<string, string> field, encoded as repeated key=1 value=2 entries
+func (m Message) Map(field int) (map[string]string, error) {
+	entries, err := m.Messages(field)
+	if err != nil {
+		return nil, err
+	}
+	values := map[string]string{}
+	for _, entry := range entries {
+		values[entry.String(1)] = entry.String(2)
+	}
+	return values, nil
+}
@@ -0,0 +1,103 @@
+package rpc
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func TestBufferRoundTrip(t *testing.T) {
+	b := &Buffer{}
+	b.Varint(1, 150)
+	b.Varint(2, math.MaxUint64)
+	b.Bool(3, true)
+	b.Fixed64(4, 1600000000123456789)
+	b.Double(5, 0.25)
+	b.String(6, "container")
+	b.Message(7, func(nested *Buffer) {
+		nested.String(1, "inner")
+		nested.Varint(2, 7)
+	})
+	for _, key := range []string{"a", "b"} {
+		b.Message(8, func(entry *Buffer) {
+			entry.String(1, key)
+			entry.String(2, key+"-value")
+		})
+	}
+
+	m, err := Parse(b.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Uint(1) != 150 || m.Uint(2) != math.MaxUint64 || m.Uint(3) != 1 || m.Uint(4) != 1600000000123456789 {
+		t.Errorf("varint and fixed fields decoded as %d %d %d %d", m.Uint(1), m.Uint(2), m.Uint(3), m.Uint(4))
+	}
+	if v := math.Float64frombits(m.Uint(5)); v != 0.25 {
+		t.Errorf("double decoded as %v", v)
+	}
+	if m.String(6) != "container" {
+		t.Errorf("string decoded as %q", m.String(6))
+	}
+	nested, err := m.Message(7)
+	if err != nil || nested.String(1) != "inner" || nested.Uint(2) != 7 {
+		t.Errorf("nested message decoded as %v, %v", nested, err)
+	}
+	entries, err := m.Map(8)
+	if err != nil || len(entries) != 2 || entries["a"] != "a-value" || entries["b"] != "b-value" {
+		t.Errorf("map decoded as %v, %v", entries, err)
+	}
+	if m.String(99) != "" || m.Uint(99) != 0 {
+		t.Error("absent fields are not empty")
+	}
+}
+
+// the encoding of a few fields checked against protoc's output
+func TestBufferWireFormat(t *testing.T) {
+	tests := []struct {
+		name  string
+		build func(*Buffer)
+		want  []byte
+	}{
+		{"varint", func(b *Buffer) { b.Varint(1, 150) }, []byte{0x08, 0x96, 0x01}},
+		{"string", func(b *Buffer) { b.String(2, "testing") }, []byte{0x12, 0x07, 't', 'e', 's', 't', 'i', 'n', 'g'}},
+		{"message", func(b *Buffer) { b.Message(3, func(n *Buffer) { n.Varint(1, 150) }) }, []byte{0x1a, 0x03, 0x08, 0x96, 0x01}},
+		{"fixed64", func(b *Buffer) { b.Fixed64(3, 1) }, []byte{0x19, 1, 0, 0, 0, 0, 0, 0, 0}},
+		{"zero double is written", func(b *Buffer) { b.Double(4, 0) }, []byte{0x21, 0, 0, 0, 0, 0, 0, 0, 0}},
+		{"zero values are omitted", func(b *Buffer) {
+			b.Varint(1, 0)
+			b.Bool(2, false)
+			b.Fixed64(3, 0)
+			b.String(4, "")
+		}, nil},
+		{"empty message is written", func(b *Buffer) { b.Message(5, func(*Buffer) {}) }, []byte{0x2a, 0x00}},
+	}
+	for _, tt := range tests {
+		b := &Buffer{}
+		tt.build(b)
+		if !bytes.Equal(b.Bytes(), tt.want) {
+			t.Errorf("%s: encoded as % x, want % x", tt.name, b.Bytes(), tt.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []byte
+	}{
+		{"truncated key", []byte{0x80}},
+		{"truncated varint", []byte{0x08, 0x96}},
+		{"truncated fixed64", []byte{0x19, 1, 0, 0}},
+		{"truncated bytes", []byte{0x12, 0x07, 't', 'e'}},
+		{"truncated fixed32", []byte{0x1d, 1}},
+		{"group wire type", []byte{0x0b}},
+	}
+	for _, tt := range tests {
+		if _, err := Parse(tt.in); err == nil {
+			t.Errorf("%s: parsed without error", tt.name)
+		}
+	}
+	if m, err := Parse(nil); err != nil || len(m) != 0 {
+		t.Errorf("empty message parsed as %v, %v", m, err)
+	}
+}
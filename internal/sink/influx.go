@@ -0,0 +1,122 @@
+package sink
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/newrelic-experimental/nri-docker/internal/lib"
+)
+
+var (
+	influxMeasurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `, "\n", `\n`)
+	influxTagEscaper         = strings.NewReplacer(",", `\,`, " ", `\ `, "=", `\=`, "\n", `\n`)
+	influxStringEscaper      = strings.NewReplacer(`"`, `\"`, `\`, `\\`, "\n", `\n`)
+)
+
+// Influx writes samples as InfluxDB line protocol, either to a write API URL or appended to a file
+type Influx struct {
+	URL   string
+	Token string
+}
+
+// NewInflux creates a sink for an http(s) write URL or a file path, token is optional
+func NewInflux(url, token string) *Influx {
+	return &Influx{URL: url, Token: token}
+}
+
+// Name of the sink
+func (s *Influx) Name() string {
+	return "influx"
+}
+
+// Publish writes one line per sample, the sample event becomes the measurement
+func (s *Influx) Publish(payload *lib.Payload) error {
+	body := &bytes.Buffer{}
+	for _, e := range payload.Entities {
+		for _, sample := range e.Samples {
+			writeInfluxLine(body, e, sample)
+		}
+	}
+	if body.Len() == 0 {
+		return nil
+	}
+
+	if !strings.HasPrefix(s.URL, "http://") && !strings.HasPrefix(s.URL, "https://") {
+		f, err := os.OpenFile(s.URL, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = body.WriteTo(f)
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, s.URL, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if s.Token != "" {
+		req.Header.Set("Authorization", "Token "+s.Token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("influx write to %s failed: %s", s.URL, resp.Status)
+	}
+	return nil
+}
+
+// writeInfluxLine writes attributes as tags and gauges as fields. Samples without
+// any gauge, such as errors, carry their attributes as string fields instead.
+func writeInfluxLine(w *bytes.Buffer, e *lib.Entity, sample *lib.Sample) {
+	tags := seriesAttributes(sample)
+	if !e.IsLocal() {
+		tags["entityName"] = e.Name
+	}
+
+	fields := []string{}
+	for key, val := range sample.Gauges() {
+		fields = append(fields, influxTagEscaper.Replace(key)+"="+strconv.FormatFloat(val, 'f', -1, 64))
+	}
+	if len(fields) == 0 {
+		for key, val := range tags {
+			fields = append(fields, influxTagEscaper.Replace(key)+`="`+influxStringEscaper.Replace(val)+`"`)
+		}
+		tags = map[string]string{}
+	}
+	if len(fields) == 0 {
+		return
+	}
+	sort.Strings(fields)
+
+	tagPairs := []string{}
+	for key, val := range tags {
+		if val != "" {
+			tagPairs = append(tagPairs, influxTagEscaper.Replace(key)+"="+influxTagEscaper.Replace(val))
+		}
+	}
+	sort.Strings(tagPairs)
+
+	w.WriteString(influxMeasurementEscaper.Replace(sample.Event))
+	for _, pair := range tagPairs {
+		w.WriteByte(',')
+		w.WriteString(pair)
+	}
+	w.WriteByte(' ')
+	w.WriteString(strings.Join(fields, ","))
+	w.WriteByte(' ')
+	w.WriteString(strconv.FormatInt(sample.Timestamp.UnixNano(), 10))
+	w.WriteByte('\n')
+}
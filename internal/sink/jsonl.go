@@ -0,0 +1,54 @@
+package sink
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+
+	"github.com/newrelic-experimental/nri-docker/internal/lib"
+)
+
+// JSONLines appends one JSON object per sample to a file
+type JSONLines struct {
+	Path string
+}
+
+// NewJSONLines creates a sink appending to path
+func NewJSONLines(path string) *JSONLines {
+	return &JSONLines{Path: path}
+}
+
+// Name of the sink
+func (j *JSONLines) Name() string {
+	return "jsonl"
+}
+
+// Publish appends every sample of the payload
+func (j *JSONLines) Publish(payload *lib.Payload) error {
+	f, err := os.OpenFile(j.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, e := range payload.Entities {
+		for _, sample := range e.Samples {
+			line := map[string]interface{}{}
+			for key, val := range sample.Metrics {
+				line[key] = val
+			}
+			line["eventType"] = sample.Event
+			line["timestamp"] = sample.Timestamp.UnixNano() / 1e6
+			if !e.IsLocal() {
+				line["entityName"] = e.Name
+				line["entityType"] = e.Namespace
+			}
+			if err := enc.Encode(line); err != nil {
+				return err
+			}
+		}
+	}
+	return w.Flush()
+}
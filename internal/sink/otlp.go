@@ -0,0 +1,186 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/newrelic-experimental/nri-docker/internal/lib"
+	"github.com/newrelic-experimental/nri-docker/internal/rpc"
+)
+
+// Supported OTLP transports
+const (
+	ProtocolHTTPProtobuf = "http/protobuf"
+	ProtocolHTTPJSON     = "http/json"
+	ProtocolGRPC         = "grpc"
+)
+
+const exportMethod = "/opentelemetry.proto.collector.metrics.v1.MetricsService/Export"
+
+// resourceAttributes maps sample attributes onto the OpenTelemetry container
+// and host semantic conventions, these are lifted onto the resource of a
+// container entity rather than repeated on every data point. Other entities,
+// eg. the host carrying one dockerTaskSample per task, keep them per data point
+var resourceAttributes = map[string]string{
+	"containerId": "container.id",
+	"imageShort":  "container.image.name",
+	"image":       "container.image.id",
+	"hostname":    "host.name",
+	"runtime":     "container.runtime",
+}
+
+// OTLP pushes samples as OpenTelemetry gauges to an OTLP metrics endpoint
+type OTLP struct {
+	Endpoint string
+	Protocol string
+	Headers  map[string]string
+	Timeout  time.Duration
+}
+
+// NewOTLP creates an OTLP sink, headers is a comma separated list of key=value pairs
+func NewOTLP(endpoint, protocol, headers string, timeout time.Duration) *OTLP {
+	e := &OTLP{
+		Endpoint: endpoint,
+		Protocol: protocol,
+		Headers:  map[string]string{},
+		Timeout:  timeout,
+	}
+	if e.Protocol == "" {
+		e.Protocol = ProtocolHTTPProtobuf
+	}
+	for _, header := range strings.Split(headers, ",") {
+		kv := strings.SplitN(header, "=", 2)
+		if len(kv) == 2 && kv[0] != "" {
+			e.Headers[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+		}
+	}
+	return e
+}
+
+// Name of the sink
+func (e *OTLP) Name() string {
+	return "otlp"
+}
+
+// Publish converts every sample of the payload and sends them in one request
+func (e *OTLP) Publish(payload *lib.Payload) error {
+	request := convertOTLP(payload)
+	if len(request.ResourceMetrics) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), e.Timeout)
+	defer cancel()
+
+	switch e.Protocol {
+	case ProtocolGRPC:
+		_, err := rpc.NewClient(e.Endpoint).Invoke(ctx, exportMethod, request.marshalProto(), e.Headers)
+		return err
+	case ProtocolHTTPJSON:
+		body, err := json.Marshal(request)
+		if err != nil {
+			return err
+		}
+		return e.post(ctx, "application/json", body)
+	case ProtocolHTTPProtobuf:
+		return e.post(ctx, "application/x-protobuf", request.marshalProto())
+	}
+	return fmt.Errorf("unsupported otlp protocol %q", e.Protocol)
+}
+
+func (e *OTLP) post(ctx context.Context, contentType string, body []byte) error {
+	url := strings.TrimSuffix(e.Endpoint, "/")
+	if !strings.HasSuffix(url, "/v1/metrics") {
+		url += "/v1/metrics"
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", contentType)
+	for key, val := range e.Headers {
+		req.Header.Set(key, val)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("otlp export to %s failed: %s", url, resp.Status)
+	}
+	return nil
+}
+
+func convertOTLP(payload *lib.Payload) *exportRequest {
+	request := &exportRequest{}
+
+	for _, entity := range payload.Entities {
+		resAttrs := map[string]string{"host.name": lib.Hostname}
+		container := entity.Namespace == "docker"
+		if container {
+			resAttrs["container.id"] = entity.Name
+			resAttrs["container.runtime"] = "docker"
+		}
+
+		metrics := map[string]*gauges{}
+		for _, sample := range entity.Samples {
+			timestamp := strconv.FormatInt(sample.Timestamp.UnixNano(), 10)
+
+			var attributes []keyValue
+			for key, val := range seriesAttributes(sample) {
+				if resKey, ok := resourceAttributes[key]; ok && container {
+					resAttrs[resKey] = val
+					continue
+				}
+				attributes = append(attributes, keyValue{Key: key, Value: anyValue{StringValue: val}})
+			}
+			sort.Slice(attributes, func(a, b int) bool { return attributes[a].Key < attributes[b].Key })
+
+			for key, val := range sample.Gauges() {
+				name := metricName(sample.Event, key)
+				if metrics[name] == nil {
+					metrics[name] = &gauges{Name: name}
+				}
+				metrics[name].Gauge.DataPoints = append(metrics[name].Gauge.DataPoints, dataPoint{
+					Attributes:   attributes,
+					TimeUnixNano: timestamp,
+					AsDouble:     val,
+				})
+			}
+		}
+		if len(metrics) == 0 {
+			continue
+		}
+
+		rm := &resourceMetrics{}
+		for key, val := range resAttrs {
+			if val != "" {
+				rm.Resource.Attributes = append(rm.Resource.Attributes, keyValue{Key: key, Value: anyValue{StringValue: val}})
+			}
+		}
+		sort.Slice(rm.Resource.Attributes, func(a, b int) bool { return rm.Resource.Attributes[a].Key < rm.Resource.Attributes[b].Key })
+
+		sm := &scopeMetrics{Scope: scope{Name: lib.IntegrationName, Version: lib.IntegrationVersion}}
+		for _, m := range metrics {
+			sm.Metrics = append(sm.Metrics, m)
+		}
+		sort.Slice(sm.Metrics, func(a, b int) bool { return sm.Metrics[a].Name < sm.Metrics[b].Name })
+		rm.ScopeMetrics = []*scopeMetrics{sm}
+		request.ResourceMetrics = append(request.ResourceMetrics, rm)
+	}
+	return request
+}
@@ -0,0 +1,113 @@
+package sink
+
+import (
+	"strconv"
+
+	"github.com/newrelic-experimental/nri-docker/internal/rpc"
+)
+
+// The types below mirror the subset of opentelemetry/proto/collector/metrics/v1
+// needed to push gauges. JSON tags follow the OTLP/JSON mapping, and the
+// marshalProto methods follow the protobuf field numbers of the same messages.
+
+type exportRequest struct {
+	ResourceMetrics []*resourceMetrics `json:"resourceMetrics"`
+}
+
+type resourceMetrics struct {
+	Resource     resource        `json:"resource"`
+	ScopeMetrics []*scopeMetrics `json:"scopeMetrics"`
+}
+
+type resource struct {
+	Attributes []keyValue `json:"attributes"`
+}
+
+type scopeMetrics struct {
+	Scope   scope     `json:"scope"`
+	Metrics []*gauges `json:"metrics"`
+}
+
+type scope struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+type gauges struct {
+	Name  string `json:"name"`
+	Gauge gauge  `json:"gauge"`
+}
+
+type gauge struct {
+	DataPoints []dataPoint `json:"dataPoints"`
+}
+
+type dataPoint struct {
+	Attributes   []keyValue `json:"attributes,omitempty"`
+	TimeUnixNano string     `json:"timeUnixNano"`
+	AsDouble     float64    `json:"asDouble"`
+}
+
+type keyValue struct {
+	Key   string   `json:"key"`
+	Value anyValue `json:"value"`
+}
+
+type anyValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+func (r *exportRequest) marshalProto() []byte {
+	b := &rpc.Buffer{}
+	for _, rm := range r.ResourceMetrics {
+		b.Message(1, rm.marshalProto)
+	}
+	return b.Bytes()
+}
+
+func (rm *resourceMetrics) marshalProto(b *rpc.Buffer) {
+	b.Message(1, func(b *rpc.Buffer) {
+		marshalAttributes(b, 1, rm.Resource.Attributes)
+	})
+	for _, sm := range rm.ScopeMetrics {
+		b.Message(2, sm.marshalProto)
+	}
+}
+
+func (sm *scopeMetrics) marshalProto(b *rpc.Buffer) {
+	b.Message(1, func(b *rpc.Buffer) {
+		b.String(1, sm.Scope.Name)
+		b.String(2, sm.Scope.Version)
+	})
+	for _, m := range sm.Metrics {
+		b.Message(2, m.marshalProto)
+	}
+}
+
+func (m *gauges) marshalProto(b *rpc.Buffer) {
+	b.String(1, m.Name)
+	b.Message(5, func(b *rpc.Buffer) {
+		for _, dp := range m.Gauge.DataPoints {
+			b.Message(1, dp.marshalProto)
+		}
+	})
+}
+
+func (dp dataPoint) marshalProto(b *rpc.Buffer) {
+	ts, _ := strconv.ParseUint(dp.TimeUnixNano, 10, 64)
+	b.Fixed64(3, ts)
+	b.Double(4, dp.AsDouble)
+	marshalAttributes(b, 7, dp.Attributes)
+}
+
+func marshalAttributes(b *rpc.Buffer, field int, attributes []keyValue) {
+	for _, kv := range attributes {
+		kv := kv
+		b.Message(field, func(b *rpc.Buffer) {
+			b.String(1, kv.Key)
+			b.Message(2, func(b *rpc.Buffer) {
+				b.String(1, kv.Value.StringValue)
+			})
+		})
+	}
+}
@@ -0,0 +1,209 @@
+package sink
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/newrelic-experimental/nri-docker/internal/lib"
+	"github.com/newrelic-experimental/nri-docker/internal/rpc"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// exported is what the stand-in collector received, flattened to metric name, value and resource attributes
+type exported struct {
+	contentType string
+	header      string
+	metrics     map[string]float64
+	resource    map[string]string
+}
+
+func testPayload() *lib.Payload {
+	payload := lib.NewPayload()
+	sample := payload.Entity("3f4e8a1b2c", "docker").NewSample("ContainerSample")
+	sample.Timestamp = time.Unix(1600000000, 0)
+	sample.Metrics["containerId"] = "3f4e8a1b2c"
+	sample.Metrics["containerName"] = "web"
+	sample.Metrics["cpuPercent"] = 12.5
+	sample.Metrics["memoryUsageBytes"] = float64(0)
+	return payload
+}
+
+// decodeProto reads an ExportMetricsServiceRequest with the same field numbers marshalProto writes
+func decodeProto(t *testing.T, body []byte, into *exported) {
+	request, err := rpc.Parse(body)
+	if err != nil {
+		// called from the server's goroutine, where Fatal must not be
+		t.Error(err)
+		return
+	}
+	resourceMetrics, _ := request.Messages(1)
+	for _, rm := range resourceMetrics {
+		res, _ := rm.Message(1)
+		attributes, _ := res.Messages(1)
+		for _, kv := range attributes {
+			val, _ := kv.Message(2)
+			into.resource[kv.String(1)] = val.String(1)
+		}
+		scopes, _ := rm.Messages(2)
+		for _, sm := range scopes {
+			metrics, _ := sm.Messages(2)
+			for _, m := range metrics {
+				gauge, _ := m.Message(5)
+				points, _ := gauge.Messages(1)
+				for _, dp := range points {
+					into.metrics[m.String(1)] = math.Float64frombits(dp.Uint(4))
+				}
+			}
+		}
+	}
+}
+
+func decodeJSON(t *testing.T, body []byte, into *exported) {
+	request := exportRequest{}
+	if err := json.Unmarshal(body, &request); err != nil {
+		t.Error(err)
+		return
+	}
+	for _, rm := range request.ResourceMetrics {
+		for _, kv := range rm.Resource.Attributes {
+			into.resource[kv.Key] = kv.Value.StringValue
+		}
+		for _, sm := range rm.ScopeMetrics {
+			for _, m := range sm.Metrics {
+				for _, dp := range m.Gauge.DataPoints {
+					into.metrics[m.Name] = dp.AsDouble
+				}
+			}
+		}
+	}
+}
+
+// collector stands in for an OTLP collector serving OTLP/HTTP on /v1/metrics and OTLP/gRPC
+func collector(t *testing.T, received chan<- exported) *httptest.Server {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		got := exported{contentType: r.Header.Get("content-type"), header: r.Header.Get("api-key"), metrics: map[string]float64{}, resource: map[string]string{}}
+		switch {
+		case r.URL.Path == exportMethod && got.contentType == "application/grpc":
+			decodeProto(t, body[5:5+binary.BigEndian.Uint32(body[1:5])], &got)
+			w.Header().Set("content-type", "application/grpc")
+			w.Write([]byte{0, 0, 0, 0, 0})
+			w.Header().Set(http.TrailerPrefix+"grpc-status", "0")
+		case r.URL.Path == "/v1/metrics" && got.contentType == "application/x-protobuf":
+			decodeProto(t, body, &got)
+		case r.URL.Path == "/v1/metrics" && got.contentType == "application/json":
+			decodeJSON(t, body, &got)
+		default:
+			http.Error(w, "unexpected "+r.URL.Path, http.StatusNotFound)
+			return
+		}
+		received <- got
+	})
+	server := httptest.NewServer(h2c.NewHandler(handler, &http2.Server{}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestOTLPPublish(t *testing.T) {
+	defer func(hostname string) { lib.Hostname = hostname }(lib.Hostname)
+	lib.Hostname = "docker-host"
+	for _, protocol := range []string{ProtocolHTTPProtobuf, ProtocolHTTPJSON, ProtocolGRPC} {
+		received := make(chan exported, 1)
+		server := collector(t, received)
+		e := NewOTLP(server.URL, protocol, "api-key=secret, other=1", 5*time.Second)
+		if err := e.Publish(testPayload()); err != nil {
+			t.Fatalf("%s: %v", protocol, err)
+		}
+		got := <-received
+
+		if got.header != "secret" {
+			t.Errorf("%s: api-key header %q", protocol, got.header)
+		}
+		want := map[string]float64{"docker.container.cpuPercent": 12.5, "docker.container.memoryUsageBytes": 0}
+		if len(got.metrics) != len(want) {
+			names := []string{}
+			for name := range got.metrics {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			t.Errorf("%s: exported %v", protocol, names)
+		}
+		for name, val := range want {
+			if v, ok := got.metrics[name]; !ok || v != val {
+				t.Errorf("%s: %s is %v, want %v", protocol, name, v, val)
+			}
+		}
+		if got.resource["container.id"] != "3f4e8a1b2c" || got.resource["host.name"] != "docker-host" {
+			t.Errorf("%s: resource %v", protocol, got.resource)
+		}
+	}
+}
+
+func TestOTLPPublishFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "overloaded", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	if err := NewOTLP(server.URL, ProtocolHTTPProtobuf, "", time.Second).Publish(testPayload()); err == nil {
+		t.Error("a rejected export is not an error")
+	}
+	if err := NewOTLP(server.URL, "thrift", "", time.Second).Publish(testPayload()); err == nil {
+		t.Error("an unknown protocol is not an error")
+	}
+}
+
+func TestConvertOTLPResource(t *testing.T) {
+	defer func(hostname string) { lib.Hostname = hostname }(lib.Hostname)
+	lib.Hostname = "docker-host"
+	payload := testPayload()
+	payload.Entities[0].Samples[0].Metrics["imageShort"] = "web:2"
+	host := payload.LocalEntity()
+	for _, image := range []string{"nginx:1", "redis:7"} {
+		sample := host.NewSample("dockerTaskSample")
+		sample.Metrics["imageShort"] = image
+		sample.Metrics["containerId"] = "id-" + image
+		sample.Metrics["desiredStateCode"] = float64(1)
+	}
+
+	request := convertOTLP(payload)
+	if len(request.ResourceMetrics) != 2 {
+		t.Fatalf("%d resources", len(request.ResourceMetrics))
+	}
+	resources := []map[string]string{}
+	for _, rm := range request.ResourceMetrics {
+		resource := map[string]string{}
+		for _, kv := range rm.Resource.Attributes {
+			resource[kv.Key] = kv.Value.StringValue
+		}
+		resources = append(resources, resource)
+	}
+	if resources[0]["container.image.name"] != "web:2" || resources[0]["container.id"] != "3f4e8a1b2c" {
+		t.Errorf("container resource %v", resources[0])
+	}
+	if _, ok := resources[1]["container.image.name"]; ok || resources[1]["host.name"] != "docker-host" {
+		t.Errorf("host resource %v", resources[1])
+	}
+
+	images := []string{}
+	for _, m := range request.ResourceMetrics[1].ScopeMetrics[0].Metrics {
+		for _, dp := range m.Gauge.DataPoints {
+			for _, kv := range dp.Attributes {
+				if kv.Key == "imageShort" {
+					images = append(images, kv.Value.StringValue)
+				}
+			}
+		}
+	}
+	sort.Strings(images)
+	if len(images) != 2 || images[0] != "nginx:1" || images[1] != "redis:7" {
+		t.Errorf("task data points carry images %v", images)
+	}
+}
@@ -0,0 +1,64 @@
+package sink
+
+import (
+	"github.com/newrelic-experimental/nri-docker/internal/lib"
+	"github.com/newrelic/infra-integrations-sdk/data/event"
+	"github.com/newrelic/infra-integrations-sdk/data/metric"
+	"github.com/newrelic/infra-integrations-sdk/integration"
+)
+
+// SDK writes the infra SDK v3 JSON payload to stdout for the infrastructure agent
+type SDK struct {
+	integration *integration.Integration
+}
+
+// NewSDK creates a sink publishing through an existing integration
+func NewSDK(i *integration.Integration) *SDK {
+	return &SDK{integration: i}
+}
+
+// Name of the sink
+func (s *SDK) Name() string {
+	return "sdk"
+}
+
+// Publish converts the payload into SDK entities, metric sets, inventory and events and prints it
+func (s *SDK) Publish(payload *lib.Payload) error {
+	for _, e := range payload.Entities {
+		entity, err := s.entity(e)
+		if err != nil {
+			return err
+		}
+		for _, sample := range e.Samples {
+			metricSet := entity.NewMetricSet(sample.Event)
+			for key, val := range sample.Metrics {
+				switch v := val.(type) {
+				case float64:
+					metricSet.SetMetric(key, v, metric.GAUGE)
+				case string:
+					metricSet.SetMetric(key, v, metric.ATTRIBUTE)
+				}
+			}
+		}
+		for key, fields := range e.Inventory {
+			for field, val := range fields {
+				if err := entity.SetInventoryItem(key, field, val); err != nil {
+					return err
+				}
+			}
+		}
+		for _, ev := range e.Events {
+			if err := entity.AddEvent(event.New(ev.Summary, ev.Category)); err != nil {
+				return err
+			}
+		}
+	}
+	return s.integration.Publish()
+}
+
+func (s *SDK) entity(e *lib.Entity) (*integration.Entity, error) {
+	if e.IsLocal() {
+		return s.integration.LocalEntity(), nil
+	}
+	return s.integration.Entity(e.Name, e.Namespace)
+}
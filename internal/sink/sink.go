@@ -0,0 +1,137 @@
+package sink
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/newrelic-experimental/nri-docker/internal/lib"
+	"github.com/newrelic/infra-integrations-sdk/integration"
+	"github.com/newrelic/infra-integrations-sdk/log"
+)
+
+// Sink publishes the samples of a collection run to one destination
+type Sink interface {
+	Name() string
+	Publish(payload *lib.Payload) error
+}
+
+// volatileAttributes change on every run, so they are kept off series identifying tags and labels
+var volatileAttributes = map[string]bool{
+	"event_type":          true,
+	"integration_version": true,
+	"status":              true,
+}
+
+// New creates the sinks named in a comma separated list, the SDK sink publishes through i
+func New(names string, i *integration.Integration) ([]Sink, error) {
+	sinks := []Sink{}
+	seen := map[string]bool{}
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		switch name {
+		case "sdk":
+			sinks = append(sinks, NewSDK(i))
+		case "jsonl":
+			if lib.Args.JSONLinesPath == "" {
+				return nil, fmt.Errorf("jsonl sink requires json_lines_path")
+			}
+			sinks = append(sinks, NewJSONLines(lib.Args.JSONLinesPath))
+		case "statsd":
+			sinks = append(sinks, NewStatsD(lib.Args.StatsdAddress))
+		case "influx":
+			if lib.Args.InfluxURL == "" {
+				return nil, fmt.Errorf("influx sink requires influx_url")
+			}
+			sinks = append(sinks, NewInflux(lib.Args.InfluxURL, lib.Args.InfluxToken))
+		case "otlp":
+			if lib.Args.OtlpEndpoint == "" {
+				return nil, fmt.Errorf("otlp sink requires otlp_endpoint")
+			}
+			sinks = append(sinks, newOTLPFromArgs())
+		default:
+			return nil, fmt.Errorf("unknown sink %q", name)
+		}
+	}
+
+	// setting an OTLP endpoint alone has always been enough to enable the export
+	if lib.Args.OtlpEndpoint != "" && !seen["otlp"] {
+		sinks = append(sinks, newOTLPFromArgs())
+	}
+	if dropped := unpublished(sinks); dropped != "" {
+		log.Warn("%s will not be published, only the sdk sink publishes them", dropped)
+	}
+	return sinks, nil
+}
+
+// unpublished names what is collected but dropped without the sdk sink, the other
+// sinks only publish samples
+func unpublished(sinks []Sink) string {
+	for _, s := range sinks {
+		if s.Name() == "sdk" {
+			return ""
+		}
+	}
+	dropped := []string{}
+	if lib.Args.ContainerInventory && lib.Args.HasInventory() {
+		dropped = append(dropped, "inventory")
+	}
+	if lib.Args.HasEvents() {
+		dropped = append(dropped, "daemon warning events")
+	}
+	return strings.Join(dropped, " and ")
+}
+
+func newOTLPFromArgs() Sink {
+	return NewOTLP(lib.Args.OtlpEndpoint, lib.Args.OtlpProtocol, lib.Args.OtlpHeaders, time.Duration(lib.Args.OtlpTimeout)*time.Second)
+}
+
+// Publish sends payload to every sink, one failing sink does not stop the others
+func Publish(sinks []Sink, payload *lib.Payload) error {
+	failed := []string{}
+	for _, s := range sinks {
+		if err := s.Publish(payload); err != nil {
+			log.Error("%s sink: %v", s.Name(), err)
+			failed = append(failed, s.Name())
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to publish to %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// seriesAttributes returns the attributes identifying the series a sample belongs to
+func seriesAttributes(s *lib.Sample) map[string]string {
+	attributes := s.Attributes()
+	for key := range attributes {
+		if volatileAttributes[key] {
+			delete(attributes, key)
+		}
+	}
+	return attributes
+}
+
+// metricName builds docker.<sample>.<metric>, eg. docker.service.replicasCurrent for dockerServiceSample
+func metricName(event, key string) string {
+	return "docker." + metricPrefix(event) + "." + key
+}
+
+// metricPrefix turns an event type such as dockerServiceSample or ContainerSample
+// into a metric namespace such as service or container
+func metricPrefix(eventType string) string {
+	name := strings.TrimPrefix(eventType, "docker")
+	name = strings.TrimSuffix(name, "Sample")
+	if name == "" {
+		return "sample"
+	}
+	r := []rune(name)
+	r[0] = unicode.ToLower(r[0])
+	return string(r)
+}
@@ -0,0 +1,35 @@
+package sink
+
+import (
+	"testing"
+
+	"github.com/newrelic-experimental/nri-docker/internal/lib"
+)
+
+func TestUnpublished(t *testing.T) {
+	defer func(args lib.ArgumentList) { lib.Args = args }(lib.Args)
+	tests := []struct {
+		names     string
+		inventory bool
+		events    bool
+		want      string
+	}{
+		{"sdk", true, true, ""},
+		{"sdk,jsonl", true, true, ""},
+		{"jsonl", false, true, "daemon warning events"},
+		{"jsonl,statsd", true, true, "inventory and daemon warning events"},
+		{"influx", true, false, "inventory"},
+	}
+	for _, tt := range tests {
+		lib.Args = lib.ArgumentList{JSONLinesPath: "/dev/null", InfluxURL: "/dev/null", ContainerInventory: tt.inventory}
+		lib.Args.Inventory = true
+		lib.Args.Events = tt.events
+		sinks, err := New(tt.names, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := unpublished(sinks); got != tt.want {
+			t.Errorf("%s: %q, want %q", tt.names, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package sink
+
+import (
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/newrelic-experimental/nri-docker/internal/lib"
+)
+
+// keep datagrams under a typical ethernet MTU
+const statsdMaxPacket = 1432
+
+// tag values may hold colons, metric names and tag keys may not
+var (
+	statsdValueReplacer = strings.NewReplacer(",", "_", "|", "_", "#", "_", "\n", "_")
+	statsdNameReplacer  = strings.NewReplacer(",", "_", "|", "_", "#", "_", "\n", "_", ":", "_")
+)
+
+// StatsD sends every gauge over UDP, attributes travel as DogStatsD style tags
+type StatsD struct {
+	Address string
+}
+
+// NewStatsD creates a sink sending to a host:port address
+func NewStatsD(address string) *StatsD {
+	return &StatsD{Address: address}
+}
+
+// Name of the sink
+func (s *StatsD) Name() string {
+	return "statsd"
+}
+
+// Publish sends the payload, packing as many lines per datagram as fit
+func (s *StatsD) Publish(payload *lib.Payload) error {
+	conn, err := net.Dial("udp", s.Address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	packet := []byte{}
+	for _, e := range payload.Entities {
+		for _, sample := range e.Samples {
+			tags := statsdTags(e, sample)
+			for key, val := range sample.Gauges() {
+				line := statsdNameReplacer.Replace(metricName(sample.Event, key)) + ":" + strconv.FormatFloat(val, 'f', -1, 64) + "|g" + tags
+				if len(packet) > 0 && len(packet)+1+len(line) > statsdMaxPacket {
+					if _, err := conn.Write(packet); err != nil {
+						return err
+					}
+					packet = packet[:0]
+				}
+				if len(packet) > 0 {
+					packet = append(packet, '\n')
+				}
+				packet = append(packet, line...)
+			}
+		}
+	}
+	if len(packet) > 0 {
+		_, err = conn.Write(packet)
+	}
+	return err
+}
+
+func statsdTags(e *lib.Entity, sample *lib.Sample) string {
+	tags := []string{}
+	if !e.IsLocal() {
+		tags = append(tags, "entityName:"+statsdValueReplacer.Replace(e.Name))
+	}
+	for key, val := range seriesAttributes(sample) {
+		tags = append(tags, statsdNameReplacer.Replace(key)+":"+statsdValueReplacer.Replace(val))
+	}
+	if len(tags) == 0 {
+		return ""
+	}
+	sort.Strings(tags)
+	return "|#" + strings.Join(tags, ",")
+}